@@ -1,19 +1,28 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"crdb/ai_ml/fraud_detection/app/pkg/agents"
 	"crdb/ai_ml/fraud_detection/app/pkg/bus"
+	"crdb/ai_ml/fraud_detection/app/pkg/health"
+	"crdb/ai_ml/fraud_detection/app/pkg/llm"
 	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"crdb/ai_ml/fraud_detection/app/pkg/notify"
+	"crdb/ai_ml/fraud_detection/app/pkg/prompt"
+	"crdb/ai_ml/fraud_detection/app/pkg/rules"
+	"crdb/ai_ml/fraud_detection/app/pkg/scoring"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/codingconcepts/env"
-	"github.com/openai/openai-go/v3"
-	"github.com/openai/openai-go/v3/option"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
@@ -31,24 +40,62 @@ func main() {
 		log.Fatalf("opening database connection: %v", err)
 	}
 
-	llm := openai.NewClient(option.WithAPIKey(e.OpenAIAPIKey))
+	llmClient, err := llm.NewClient(llm.Config{
+		Provider: llm.Provider(e.LLMProvider),
+		Model:    e.LLMModel,
+		BaseURL:  e.LLMBaseURL,
+		APIKey:   e.OpenAIAPIKey,
 
-	dependencies := agents.NewDependencies(b, db, llm, e.Region, e.Topic)
+		RateLimit:       e.LLMRateLimit,
+		RateBurst:       e.LLMRateBurst,
+		Timeout:         e.LLMTimeout,
+		BreakerFailures: e.LLMBreakerFailures,
+		BreakerCooldown: e.LLMBreakerCooldown,
+	})
+	if err != nil {
+		log.Fatalf("creating llm client: %v", err)
+	}
+
+	types, err := models.ParseAgentTypes(e.AgentType)
+	if err != nil {
+		log.Fatalf("parsing agent types: %v", err)
+	}
+
+	if len(types) > 1 && (e.Topic != "" || e.GroupID != "" || e.DeadLetterTopic != "") {
+		log.Fatalf("TOPIC, GROUP_ID and DEAD_LETTER_TOPIC can only be set when running a single agent")
+	}
 
-	var a agents.Agent
+	checks := health.NewChecker()
+	checks.Add("database", db.PingContext)
 
-	switch e.AgentType {
-	case string(models.AgentTypeAnomalyDetection):
-		a = agents.NewAnomalyDetection(dependencies)
-	case string(models.AgentTypeReasoning):
-		a = agents.NewReasoning(dependencies)
-	case string(models.AgentTypeNotification):
-		a, err = agents.NewNotification(dependencies)
+	var running []agents.Agent
+	for _, t := range types {
+		a, dependencies, err := newAgent(e, t, len(types) > 1, b, db, llmClient)
 		if err != nil {
-			log.Fatalf("error creating agent: %v", err)
+			log.Fatalf("error creating %s agent: %v", t, err)
+		}
+
+		running = append(running, a)
+		checks.Add("bus."+string(t), dependencies.ConsumersReady)
+
+		if t == models.AgentTypeReasoning {
+			checks.Add("llm", func(ctx context.Context) error {
+				return llm.Ready(ctx, llmClient)
+			})
 		}
 	}
 
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	checks.Register(mux)
+
+	server := &http.Server{Addr: e.HTTPAddr, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("error serving http: %v", err)
+		}
+	}()
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -56,10 +103,132 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-	go func() {
-		a.Run(ctx)
-	}()
+	for _, a := range running {
+		go a.Run(ctx)
+	}
 
 	<-sigChan
+	log.Printf("shutting down")
+
+	// Stop fetching new messages and give in-flight ones time to be handled
+	// and committed before the process exits.
 	cancel()
+
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), e.ShutdownTimeout)
+	defer drainCancel()
+
+	if err = b.Drain(drainCtx); err != nil {
+		log.Printf("error draining bus: %v", err)
+	}
+
+	if err = server.Shutdown(drainCtx); err != nil {
+		log.Printf("error shutting down http server: %v", err)
+	}
+
+	if err = b.Close(); err != nil {
+		log.Printf("error closing bus: %v", err)
+	}
+
+	if err = db.Close(); err != nil {
+		log.Printf("error closing database: %v", err)
+	}
+}
+
+// newAgent creates an agent of the given type. A single agent reads the topic
+// and joins the group it's configured with, otherwise each agent uses its own
+// defaults so they can share a process.
+func newAgent(e models.Environment, t models.AgentType, shared bool, b bus.Bus, db *sql.DB, llmClient llm.Client) (agents.Agent, *agents.Dependencies, error) {
+	topic, groupID, deadLetterTopic := t.Topic(), t.GroupID(), t.DeadLetterTopic()
+	if !shared {
+		topic, groupID, deadLetterTopic = cmp.Or(e.Topic, topic), cmp.Or(e.GroupID, groupID), cmp.Or(e.DeadLetterTopic, deadLetterTopic)
+	}
+
+	retry := bus.RetryPolicy{
+		MaxAttempts:     e.RetryMaxAttempts,
+		InitialBackoff:  e.RetryInitialBackoff,
+		MaxBackoff:      e.RetryMaxBackoff,
+		MaxDeferral:     e.RetryMaxDeferral,
+		DeadLetterTopic: deadLetterTopic,
+	}
+
+	dependencies := agents.NewDependencies(
+		b, db, llmClient, e.Region, topic,
+		bus.WithGroup(groupID),
+		bus.WithRetry(retry),
+		bus.WithWorkers(e.ConsumerWorkers),
+		bus.WithEnvelope(e.Envelope),
+	)
+
+	switch t {
+	case models.AgentTypeAnomalyDetection:
+		scorer, err := scoring.NewScorer(
+			scoring.Name(e.AnomalyStrategy),
+			e.AnomalyThreshold,
+			e.AnomalyMinHistory,
+			scoring.Baseline(e.AnomalyFallbackBaseline),
+			e.AnomalyFalsePositiveWeight,
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("creating scorer: %w", err)
+		}
+
+		ruleset, err := rules.Load(e.RulesFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading rules: %w", err)
+		}
+
+		engine, err := rules.NewEngine(ruleset)
+		if err != nil {
+			return nil, nil, fmt.Errorf("creating rule engine: %w", err)
+		}
+
+		return agents.NewAnomalyDetection(dependencies, scorer, engine), dependencies, nil
+	case models.AgentTypeReasoning:
+		templates := prompt.Default()
+		if e.PromptDir != "" {
+			templates = os.DirFS(e.PromptDir)
+		}
+
+		prompter, err := prompt.NewPrompter(templates, prompt.Config{
+			Version:        e.PromptVersion,
+			Variant:        e.PromptVariant,
+			VariantPercent: e.PromptVariantPercent,
+			CompanyName:    e.CompanyName,
+			FallbackLocale: e.PromptFallbackLocale,
+			ReloadInterval: e.PromptReloadInterval,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("creating prompter: %w", err)
+		}
+
+		var cache *llm.Cache
+		if e.LLMCacheSize > 0 {
+			cache = llm.NewCache(e.LLMCacheSize, e.LLMCacheTTL)
+		}
+
+		return agents.NewReasoning(dependencies, prompter, agents.ReasoningConfig{
+			Attempts:       e.ReasoningAttempts,
+			Cache:          cache,
+			CacheRounding:  e.LLMCacheRounding,
+			ReviewRequired: e.ReviewRequired,
+		}), dependencies, nil
+	case models.AgentTypeNotification:
+		router, err := notify.NewRouter(context.Background(), notify.Config{
+			Email:        notify.Sender(e.NotifyEmail),
+			SMS:          notify.Sender(e.NotifySMS),
+			Region:       e.Region,
+			From:         e.NotifyFrom,
+			SMTPAddr:     e.SMTPAddr,
+			SMTPUsername: e.SMTPUsername,
+			SMTPPassword: e.SMTPPassword,
+			WebhookURL:   e.NotifyWebhookURL,
+			FilePath:     e.NotifyFile,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("creating notifier: %w", err)
+		}
+		return agents.NewNotification(dependencies, router), dependencies, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported agent type: %q", t)
+	}
 }
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"crdb/ai_ml/fraud_detection/app/pkg/backtest"
+	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"crdb/ai_ml/fraud_detection/app/pkg/rules"
+	"crdb/ai_ml/fraud_detection/app/pkg/scoring"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/codingconcepts/env"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// environment is the anomaly detection agent's configuration, so purchases
+// are replayed the way it would score them.
+type environment struct {
+	DatabaseDriver string `env:"DATABASE_DRIVER" default:"pgx"`
+	DatabaseURL    string `env:"DATABASE_URL" required:"true"`
+
+	AnomalyStrategy            string  `env:"ANOMALY_STRATEGY" default:"l2"`
+	AnomalyThreshold           float64 `env:"ANOMALY_THRESHOLD"`
+	AnomalyMinHistory          int     `env:"ANOMALY_MIN_HISTORY" default:"5"`
+	AnomalyFallbackBaseline    string  `env:"ANOMALY_FALLBACK_BASELINE" default:"cohort"`
+	AnomalyFalsePositiveWeight float64 `env:"ANOMALY_FALSE_POSITIVE_WEIGHT"`
+	RulesFile                  string  `env:"RULES_FILE"`
+
+	Envelope models.Envelope `env:"ENVELOPE" default:"wrapped"`
+}
+
+func main() {
+	log.SetFlags(0)
+
+	from := flag.String("from", "", "replay purchases made at or after this time (RFC 3339, default 7 days before -to)")
+	to := flag.String("to", "", "replay purchases made before this time (RFC 3339, default now)")
+	dump := flag.String("dump", "", "replay purchases from a dump of the purchase topic, which must also be in the database")
+	thresholds := flag.String("thresholds", "", "comma-separated thresholds to evaluate (default spread across the scores)")
+	steps := flag.Int("steps", 10, "number of thresholds to spread across the scores, if -thresholds isn't set")
+	skipRules := flag.Bool("skip-rules", false, "evaluate scores alone, without the rules")
+	flag.Parse()
+
+	var e environment
+	if err := env.Set(&e); err != nil {
+		log.Fatalf("setting variables from environment: %v", err)
+	}
+
+	fixed, err := parseThresholds(*thresholds)
+	if err != nil {
+		log.Fatalf("parsing thresholds: %v", err)
+	}
+
+	db, err := sql.Open(e.DatabaseDriver, e.DatabaseURL)
+	if err != nil {
+		log.Fatalf("opening database connection: %v", err)
+	}
+	defer db.Close()
+
+	replayer, err := newReplayer(e, db, *skipRules)
+	if err != nil {
+		log.Fatalf("creating replayer: %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	purchases, err := readPurchases(ctx, db, e.Envelope, *dump, *from, *to)
+	if err != nil {
+		log.Fatalf("reading purchases: %v", err)
+	}
+	log.Printf("replaying %d purchases", len(purchases))
+
+	samples := make([]backtest.Sample, 0, len(purchases))
+	for i, p := range purchases {
+		s, err := replayer.Replay(ctx, p)
+		if err != nil {
+			log.Fatalf("replaying purchase %s: %v", p.ID, err)
+		}
+		samples = append(samples, s)
+
+		if (i+1)%1000 == 0 {
+			log.Printf("replayed %d purchases", i+1)
+		}
+	}
+
+	groups := backtest.ByStrategy(samples)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "strategy\tthreshold\tpurchases\talerts\talert rate\tprecision\trecall\tfraud missed\t")
+
+	for _, name := range backtest.Strategies(groups) {
+		ts := fixed
+		if ts == nil {
+			ts = backtest.Thresholds(groups[name], *steps)
+		}
+
+		for _, r := range backtest.Evaluate(groups[name], ts) {
+			threshold := strconv.FormatFloat(r.Threshold, 'f', 4, 64)
+			if r.Configured {
+				threshold = "configured"
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%.2f%%\t%.2f%%\t%.2f%%\t%d\t\n",
+				r.Strategy, threshold, r.Purchases, r.Alerts,
+				r.AlertRate()*100, r.Precision()*100, r.Recall()*100, r.FalseNegatives)
+		}
+	}
+
+	if err = w.Flush(); err != nil {
+		log.Fatalf("writing report: %v", err)
+	}
+}
+
+func newReplayer(e environment, db *sql.DB, skipRules bool) (*backtest.Replayer, error) {
+	scorer, err := scoring.NewScorer(
+		scoring.Name(e.AnomalyStrategy),
+		e.AnomalyThreshold,
+		e.AnomalyMinHistory,
+		scoring.Baseline(e.AnomalyFallbackBaseline),
+		e.AnomalyFalsePositiveWeight,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating scorer: %w", err)
+	}
+
+	var ruleset []rules.Rule
+	if !skipRules {
+		if ruleset, err = rules.Load(e.RulesFile); err != nil {
+			return nil, fmt.Errorf("loading rules: %w", err)
+		}
+	}
+
+	engine, err := rules.NewEngine(ruleset)
+	if err != nil {
+		return nil, fmt.Errorf("creating rule engine: %w", err)
+	}
+
+	return backtest.NewReplayer(db, scorer, engine), nil
+}
+
+func readPurchases(ctx context.Context, db *sql.DB, envelope models.Envelope, dump, from, to string) ([]models.PurchaseMessage, error) {
+	if dump != "" {
+		f, err := os.Open(dump)
+		if err != nil {
+			return nil, fmt.Errorf("opening dump: %w", err)
+		}
+		defer f.Close()
+
+		return backtest.ReadDump(f, envelope)
+	}
+
+	end := time.Now()
+	if to != "" {
+		var err error
+		if end, err = time.Parse(time.RFC3339, to); err != nil {
+			return nil, fmt.Errorf("parsing -to: %w", err)
+		}
+	}
+
+	start := end.AddDate(0, 0, -7)
+	if from != "" {
+		var err error
+		if start, err = time.Parse(time.RFC3339, from); err != nil {
+			return nil, fmt.Errorf("parsing -from: %w", err)
+		}
+	}
+
+	return backtest.Purchases(ctx, db, start, end)
+}
+
+func parseThresholds(s string) ([]float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var thresholds []float64
+	for _, part := range strings.Split(s, ",") {
+		t, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %q: %w", part, err)
+		}
+		thresholds = append(thresholds, t)
+	}
+
+	return thresholds, nil
+}
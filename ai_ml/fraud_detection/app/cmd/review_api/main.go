@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"crdb/ai_ml/fraud_detection/app/pkg/feedback"
+	"crdb/ai_ml/fraud_detection/app/pkg/health"
+	"crdb/ai_ml/fraud_detection/app/pkg/review"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/codingconcepts/env"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+type environment struct {
+	DatabaseDriver  string        `env:"DATABASE_DRIVER" default:"pgx"`
+	DatabaseURL     string        `env:"DATABASE_URL" required:"true"`
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" default:"10s"`
+
+	// The analyst review API and the customer feedback endpoint are served
+	// separately, each requiring its own bearer token.
+	HTTPAddr      string `env:"HTTP_ADDR" default:":9091"`
+	ReviewToken   string `env:"REVIEW_API_TOKEN" required:"true"`
+	FeedbackAddr  string `env:"FEEDBACK_ADDR" default:":9092"`
+	FeedbackToken string `env:"FEEDBACK_API_TOKEN" required:"true"`
+}
+
+func main() {
+	log.SetFlags(0)
+
+	var e environment
+	if err := env.Set(&e); err != nil {
+		log.Fatalf("setting variables from environment: %v", err)
+	}
+
+	// Customers mustn't be able to use their token to review anomalies.
+	if e.ReviewToken == e.FeedbackToken {
+		log.Fatal("REVIEW_API_TOKEN and FEEDBACK_API_TOKEN must differ")
+	}
+
+	db, err := sql.Open(e.DatabaseDriver, e.DatabaseURL)
+	if err != nil {
+		log.Fatalf("opening database connection: %v", err)
+	}
+	defer db.Close()
+
+	checks := health.NewChecker()
+	checks.Add("database", db.PingContext)
+
+	reviews := http.NewServeMux()
+	review.Register(reviews, review.NewStore(db))
+
+	mux := http.NewServeMux()
+	mux.Handle("/", review.RequireToken(e.ReviewToken, reviews))
+	checks.Register(mux)
+
+	replies := http.NewServeMux()
+	feedback.Register(replies, feedback.NewStore(db))
+
+	servers := []*http.Server{
+		serve("review api", e.HTTPAddr, mux),
+		serve("feedback endpoint", e.FeedbackAddr, review.RequireToken(e.FeedbackToken, replies)),
+	}
+
+	// Gracefully handle shutdown.
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	<-sigChan
+	log.Printf("shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.ShutdownTimeout)
+	defer cancel()
+
+	for _, server := range servers {
+		if err = server.Shutdown(ctx); err != nil {
+			log.Printf("error shutting down http server: %v", err)
+		}
+	}
+}
+
+func serve(name, addr string, h http.Handler) *http.Server {
+	server := &http.Server{Addr: addr, Handler: h}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("error serving %s: %v", name, err)
+		}
+	}()
+	log.Printf("serving %s on %s", name, addr)
+
+	return server
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"crdb/ai_ml/fraud_detection/app/pkg/review"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	titleStyle = lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("#6933ff"))
+
+	helpStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#d6dbe7"))
+
+	detailStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#00fced"))
+
+	selectedStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#ec3f96"))
+
+	statusStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#ffcc00"))
+)
+
+const requestTimeout = 10 * time.Second
+
+func main() {
+	url := flag.String("url", "http://localhost:9091", "base url of the review api")
+	token := flag.String("token", os.Getenv("REVIEW_API_TOKEN"), "bearer token for the review api")
+	reviewer := flag.String("reviewer", os.Getenv("USER"), "name recorded against reviews")
+	limit := flag.Int("limit", 50, "maximum number of anomalies to list")
+	flag.Parse()
+
+	if *reviewer == "" {
+		log.Fatal("a reviewer is required")
+	}
+
+	if *token == "" {
+		log.Fatal("a token is required")
+	}
+
+	p := tea.NewProgram(initialModel(review.NewClient(*url, *token), *reviewer, *limit), tea.WithAltScreen())
+	if _, err := p.Run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type itemsLoadedMsg struct {
+	items []review.Item
+	err   error
+}
+
+type decidedMsg struct {
+	decision review.Decision
+	err      error
+}
+
+type anomalyItem struct {
+	review.Item
+}
+
+func (i anomalyItem) FilterValue() string { return i.PurchaseID }
+func (i anomalyItem) Title() string       { return i.PurchaseID }
+func (i anomalyItem) Description() string { return "" }
+
+type customDelegate struct {
+	list.DefaultDelegate
+}
+
+func (d customDelegate) Height() int  { return 1 }
+func (d customDelegate) Spacing() int { return 0 }
+
+func (d customDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	i, ok := item.(anomalyItem)
+	if !ok {
+		return
+	}
+
+	message := "awaiting message"
+	if i.Message != nil {
+		message = fmt.Sprintf("%s (%.0f%%)", i.Message.Action, i.Message.Confidence*100)
+	}
+
+	str := fmt.Sprintf("%s  %10.2f  score %.3f  %s", i.Timestamp.Format(time.DateTime), i.Amount, i.Score, message)
+
+	if index == m.Index() {
+		str = selectedStyle.Render("| " + str)
+	} else {
+		str = "  " + str
+	}
+
+	fmt.Fprint(w, str)
+}
+
+type model struct {
+	queue    review.Queue
+	reviewer string
+	limit    int
+	list     list.Model
+	status   string
+	loading  bool
+	err      error
+	width    int
+	height   int
+}
+
+func initialModel(q review.Queue, reviewer string, limit int) model {
+	delegate := customDelegate{DefaultDelegate: list.NewDefaultDelegate()}
+	l := list.New([]list.Item{}, delegate, 0, 0)
+
+	l.SetShowTitle(false)
+	l.SetShowHelp(false)
+	l.SetShowStatusBar(false)
+	l.SetFilteringEnabled(false)
+
+	return model{
+		queue:    q,
+		reviewer: reviewer,
+		limit:    limit,
+		list:     l,
+		loading:  true,
+	}
+}
+
+func (m model) Init() tea.Cmd {
+	return loadItemsCmd(m.queue, m.limit)
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "q":
+			return m, tea.Quit
+
+		case "r":
+			m.loading = true
+			m.status = ""
+			return m, loadItemsCmd(m.queue, m.limit)
+
+		case "c", "d", "a":
+			selected, ok := m.list.SelectedItem().(anomalyItem)
+			if !ok {
+				return m, nil
+			}
+
+			outcomes := map[string]review.Outcome{
+				"c": review.OutcomeConfirmedFraud,
+				"d": review.OutcomeDismissed,
+				"a": review.OutcomeApproved,
+			}
+
+			d := review.Decision{
+				PurchaseID: selected.PurchaseID,
+				CustomerID: selected.CustomerID,
+				Outcome:    outcomes[msg.String()],
+				Reviewer:   m.reviewer,
+			}
+			return m, decideCmd(m.queue, d)
+		}
+
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		m.list.SetSize(msg.Width, max(msg.Height/2, 5))
+
+	case itemsLoadedMsg:
+		m.loading = false
+		if msg.err != nil {
+			m.err = msg.err
+			return m, tea.Quit
+		}
+
+		items := make([]list.Item, len(msg.items))
+		for i, item := range msg.items {
+			items[i] = anomalyItem{Item: item}
+		}
+		m.list.SetItems(items)
+		return m, nil
+
+	case decidedMsg:
+		switch {
+		case errors.Is(msg.err, review.ErrNoMessage):
+			m.status = "There's no message to approve yet; confirm or dismiss instead."
+			return m, nil
+		case errors.Is(msg.err, review.ErrAlreadyReviewed), errors.Is(msg.err, review.ErrNotFound):
+			m.status = fmt.Sprintf("Purchase %s has already been reviewed.", msg.decision.PurchaseID)
+		case msg.err != nil:
+			m.status = fmt.Sprintf("Error: %v", msg.err)
+			return m, nil
+		default:
+			m.status = fmt.Sprintf("Recorded %s for purchase %s.", msg.decision.Outcome, msg.decision.PurchaseID)
+		}
+
+		// The selection may have moved since the decision was made.
+		for i, item := range m.list.Items() {
+			if item.(anomalyItem).PurchaseID == msg.decision.PurchaseID {
+				m.list.RemoveItem(i)
+				break
+			}
+		}
+		return m, nil
+	}
+
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+func (m model) View() string {
+	if m.err != nil {
+		return fmt.Sprintf("\nError: %v\n", m.err)
+	}
+
+	var b strings.Builder
+
+	b.WriteString(titleStyle.Render(fmt.Sprintf("Anomalies awaiting review (%d)", len(m.list.Items()))))
+	b.WriteString("\n\n")
+
+	switch {
+	case m.loading:
+		b.WriteString("Loading anomalies...\n")
+	case len(m.list.Items()) == 0:
+		b.WriteString("Nothing to review.\n")
+	default:
+		b.WriteString(m.list.View())
+	}
+
+	if selected, ok := m.list.SelectedItem().(anomalyItem); ok && !m.loading {
+		b.WriteString("\n\n")
+		b.WriteString(titleStyle.Render(fmt.Sprintf("Purchase %s", selected.PurchaseID)))
+		b.WriteString("\n")
+		b.WriteString(detailView(selected.Item))
+	}
+
+	if m.status != "" {
+		b.WriteString("\n")
+		b.WriteString(statusStyle.Render(m.status))
+	}
+
+	content := b.String()
+	helpText := helpStyle.Render("c: confirm fraud • d: dismiss • a: approve message • r: refresh • q: quit")
+
+	contentLines := strings.Count(content, "\n")
+
+	if m.height > 0 {
+		paddingNeeded := m.height - contentLines - 2
+		if paddingNeeded > 0 {
+			content += strings.Repeat("\n", paddingNeeded)
+		}
+	}
+
+	return content + "\n" + helpText + "\n"
+}
+
+func detailView(i review.Item) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "  Customer: %s\n", i.CustomerID)
+	fmt.Fprintf(&b, "  Scored %.3f with %s against the %s baseline\n", i.Score, i.Strategy, i.Baseline)
+
+	b.WriteString("  Contributions:\n")
+	for _, c := range i.Breakdown {
+		fmt.Fprintf(&b, "    %-12s %6.2f%%\n", c.Dimension, c.Percent)
+	}
+
+	if i.Message == nil {
+		b.WriteString("  Message: not generated yet\n")
+		return detailStyle.Render(b.String())
+	}
+
+	fmt.Fprintf(&b, "  Recommended: %s (%.0f%% confident), because %s\n", i.Message.Action, i.Message.Confidence*100, i.Message.PrimaryReason)
+	fmt.Fprintf(&b, "  Message (%s): %s\n", i.Message.Status, i.Message.Text)
+
+	return detailStyle.Render(b.String())
+}
+
+func loadItemsCmd(q review.Queue, limit int) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+
+		items, err := q.Pending(ctx, limit)
+		return itemsLoadedMsg{items: items, err: err}
+	}
+}
+
+func decideCmd(q review.Queue, d review.Decision) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+
+		return decidedMsg{decision: d, err: q.Decide(ctx, d)}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"crdb/ai_ml/fraud_detection/app/pkg/workload"
+	"database/sql"
+	"errors"
+	"flag"
+	"log"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/codingconcepts/env"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+type environment struct {
+	DatabaseDriver string `env:"DATABASE_DRIVER" default:"pgx"`
+	DatabaseURL    string `env:"DATABASE_URL" required:"true"`
+}
+
+func main() {
+	log.SetFlags(0)
+
+	customers := flag.Int("customers", 0, "number of customers to create, in addition to any that exist")
+	history := flag.Int("history", 20, "number of past purchases to give each new customer")
+	qps := flag.Float64("qps", 1, "purchases to make per second")
+	duration := flag.Duration("duration", 0, "how long to make purchases for (0 runs until interrupted, -1 stops after creating customers)")
+	fraudRate := flag.Float64("fraud-rate", 0.01, "chance that a purchase is fraud, from 0 to 1")
+	patterns := flag.String("patterns", "all", "comma-separated fraud patterns to inject (foreign_location, odd_hour, large_amount, burst)")
+	burstSize := flag.Int("burst-size", 5, "number of purchases in a burst")
+	burstWindow := flag.Duration("burst-window", 20*time.Second, "longest gap between purchases in a burst")
+	seed := flag.Uint64("seed", 0, "seed for the generator (0 picks one at random)")
+	flag.Parse()
+
+	var e environment
+	if err := env.Set(&e); err != nil {
+		log.Fatalf("setting variables from environment: %v", err)
+	}
+
+	injected, err := workload.ParsePatterns(*patterns)
+	if err != nil {
+		log.Fatalf("parsing patterns: %v", err)
+	}
+
+	if *seed == 0 {
+		*seed = rand.Uint64()
+	}
+	log.Printf("generating with seed %d", *seed)
+
+	g, err := workload.NewGenerator(workload.Config{
+		FraudRate:   *fraudRate,
+		Patterns:    injected,
+		BurstSize:   *burstSize,
+		BurstWindow: *burstWindow,
+	}, *seed)
+	if err != nil {
+		log.Fatalf("creating generator: %v", err)
+	}
+
+	db, err := sql.Open(e.DatabaseDriver, e.DatabaseURL)
+	if err != nil {
+		log.Fatalf("opening database connection: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	store := workload.NewStore(db)
+
+	if err = createCustomers(ctx, store, g, *customers, *history); err != nil {
+		log.Fatalf("creating customers: %v", err)
+	}
+
+	if *duration < 0 {
+		return
+	}
+
+	if *qps <= 0 {
+		log.Fatalf("qps must be positive: %v", *qps)
+	}
+
+	if *duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	if err = makePurchases(ctx, store, g, *qps); err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		log.Fatalf("making purchases: %v", err)
+	}
+}
+
+// createCustomers creates customers, each with a history of purchases so
+// they have a baseline before fraud is injected.
+func createCustomers(ctx context.Context, store *workload.Store, g *workload.Generator, n, history int) error {
+	now := time.Now()
+
+	for i := range n {
+		c := g.Customer()
+
+		if err := store.CreateCustomer(ctx, c); err != nil {
+			return err
+		}
+
+		if err := store.Insert(ctx, g.History(c.ID, c.Habit, history, now)); err != nil {
+			return err
+		}
+
+		if (i+1)%100 == 0 {
+			log.Printf("created %d customers", i+1)
+		}
+	}
+
+	return nil
+}
+
+// makePurchases makes purchases for random customers until the context is
+// done.
+func makePurchases(ctx context.Context, store *workload.Store, g *workload.Generator, qps float64) error {
+	customers, err := store.Customers(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(customers) == 0 {
+		return errors.New("there are no customers to make purchases for")
+	}
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / qps))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case now := <-ticker.C:
+			id := g.Pick(customers)
+			purchases := g.Next(id, workload.HabitFor(id), now)
+
+			if err = store.Insert(ctx, purchases); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				log.Printf("error inserting purchases: %v", err)
+				continue
+			}
+
+			if pattern := purchases[0].Pattern; pattern != "" {
+				log.Printf("injected %s fraud for customer %s (%d purchases, vector %s)", pattern, id, len(purchases), purchases[0].Vector())
+			}
+		}
+	}
+}
@@ -3,11 +3,18 @@ package agents
 import (
 	"context"
 	"crdb/ai_ml/fraud_detection/app/pkg/bus"
+	"crdb/ai_ml/fraud_detection/app/pkg/llm"
+	"crdb/ai_ml/fraud_detection/app/pkg/metrics"
 	"crdb/ai_ml/fraud_detection/app/pkg/models"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
-	"github.com/openai/openai-go/v3"
 )
 
 type Agent interface {
@@ -16,20 +23,159 @@ type Agent interface {
 	Process(ctx context.Context, msg models.Message) error
 }
 
+// queryer is satisfied by both *sql.DB and *sql.Tx, for queries that can run
+// inside or outside of a transaction.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 type Dependencies struct {
-	Bus    *bus.KafkaBus
+	Bus    bus.Bus
 	DB     *sql.DB
-	LLM    openai.Client
+	LLM    llm.Client
 	Region string
 	Topic  string
+
+	// ConsumerOptions configure the consumer each agent reads its topic with.
+	ConsumerOptions []bus.ConsumerOption
+
+	mu        sync.Mutex
+	consumers []bus.Consumer
 }
 
-func NewDependencies(bus *bus.KafkaBus, db *sql.DB, llm openai.Client, region, topic string) *Dependencies {
+func NewDependencies(b bus.Bus, db *sql.DB, llm llm.Client, region, topic string, opts ...bus.ConsumerOption) *Dependencies {
 	return &Dependencies{
-		Bus:    bus,
-		DB:     db,
-		LLM:    llm,
-		Region: region,
-		Topic:  topic,
+		Bus:             b,
+		DB:              db,
+		LLM:             llm,
+		Region:          region,
+		Topic:           topic,
+		ConsumerOptions: opts,
+	}
+}
+
+// newConsumer creates a consumer for an agent's topic, ordering messages by
+// customer.
+func (d *Dependencies) newConsumer(name string) bus.Consumer {
+	opts := append([]bus.ConsumerOption{
+		bus.WithName(name),
+		bus.WithOrderingKey(byCustomer),
+	}, d.ConsumerOptions...)
+
+	c := d.Bus.NewConsumer(d.Topic, opts...)
+
+	d.mu.Lock()
+	d.consumers = append(d.consumers, c)
+	d.mu.Unlock()
+
+	return c
+}
+
+// ConsumersReady returns an error until every agent using these dependencies
+// has started consuming and been assigned partitions.
+func (d *Dependencies) ConsumersReady(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.consumers) == 0 {
+		return errors.New("no consumers started")
+	}
+
+	for _, c := range d.consumers {
+		if err := c.Ready(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// byCustomer orders messages by the customer they relate to, so that each
+// customer's purchases, anomalies and notifications are handled in order.
+func byCustomer(m models.Message) string {
+	var msg struct {
+		CustomerID string `json:"customer_id"`
+	}
+
+	parse := models.ParsePayload
+	if len(m.Payload) == 0 {
+		parse = models.ParseBefore
+	}
+
+	if err := parse(m, &msg); err != nil {
+		return ""
+	}
+
+	return msg.CustomerID
+}
+
+// fetchRow fills in the row of a key_only message, which only carries the
+// row's primary key, by looking the row up with the given key columns. The row
+// is read as JSON, in the shape changefeeds emit it in, and a row that no
+// longer exists is treated as deleted. Other messages are returned as they are.
+func (d *Dependencies) fetchRow(ctx context.Context, agent string, m models.Message, table string, key ...string) (models.Message, error) {
+	if m.Operation != models.OperationUnknown {
+		return m, nil
+	}
+	defer metrics.ObserveQuery(agent, "fetch_"+table, time.Now())
+
+	if len(m.Key) != len(key) {
+		return models.Message{}, bus.Permanent(fmt.Errorf("%s key has %d values rather than %d", table, len(m.Key), len(key)))
 	}
+
+	where := make([]string, len(key))
+	args := make([]any, len(key))
+	for i, column := range key {
+		where[i] = fmt.Sprintf("%s = $%d", column, i+1)
+		args[i] = m.Key[i]
+	}
+
+	stmt := fmt.Sprintf(`SELECT row_to_json(t.*)::STRING FROM %s AS t WHERE %s`, table, strings.Join(where, " AND "))
+
+	var row string
+	err := d.DB.QueryRowContext(ctx, stmt, args...).Scan(&row)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.Operation = models.OperationDelete
+		return m, nil
+	}
+	if err != nil {
+		return models.Message{}, fmt.Errorf("fetching %s row: %w", table, err)
+	}
+
+	m.Operation = models.OperationUpsert
+	m.Payload = json.RawMessage(row)
+	return m, nil
+}
+
+// enteredStatus reports whether a change moved a row into the given status,
+// as opposed to updating a row that was already in it. Deletes never enter a
+// status.
+func enteredStatus(m models.Message, status string) (bool, error) {
+	if m.Operation == models.OperationDelete {
+		return false, nil
+	}
+
+	var after, before struct {
+		Status string `json:"status"`
+	}
+
+	if err := models.ParsePayload(m, &after); err != nil {
+		return false, bus.Permanent(fmt.Errorf("parsing row: %w", err))
+	}
+
+	if after.Status != status {
+		return false, nil
+	}
+
+	if m.Operation != models.OperationUpdate {
+		return true, nil
+	}
+
+	if err := models.ParseBefore(m, &before); err != nil {
+		return false, bus.Permanent(fmt.Errorf("parsing previous row: %w", err))
+	}
+
+	return before.Status != status, nil
 }
@@ -2,30 +2,34 @@ package agents
 
 import (
 	"context"
+	"crdb/ai_ml/fraud_detection/app/pkg/bus"
+	"crdb/ai_ml/fraud_detection/app/pkg/metrics"
 	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"crdb/ai_ml/fraud_detection/app/pkg/rules"
+	"crdb/ai_ml/fraud_detection/app/pkg/scoring"
 	"fmt"
 	"log"
+	"slices"
 	"time"
 )
 
 type AnomalyDetection struct {
-	d *Dependencies
-
-	delays chan time.Duration
+	d      *Dependencies
+	scorer *scoring.Scorer
+	rules  *rules.Engine
 }
 
-func NewAnomalyDetection(d *Dependencies) *AnomalyDetection {
+func NewAnomalyDetection(d *Dependencies, scorer *scoring.Scorer, rules *rules.Engine) *AnomalyDetection {
 	return &AnomalyDetection{
 		d:      d,
-		delays: make(chan time.Duration, 10),
+		scorer: scorer,
+		rules:  rules,
 	}
 }
 
-// Run blocks forever.
+// Run blocks until the context is cancelled.
 func (a *AnomalyDetection) Run(ctx context.Context) {
-	go a.log()
-
-	c := a.d.Bus.NewConsumer(a.d.Topic)
+	c := a.d.newConsumer(a.Name())
 	c.Run(ctx, a.Process)
 }
 
@@ -34,86 +38,97 @@ func (a *AnomalyDetection) Name() string {
 }
 
 func (a *AnomalyDetection) Process(ctx context.Context, m models.Message) error {
+	m, err := a.d.fetchRow(ctx, a.Name(), m, "purchase", "id")
+	if err != nil {
+		return err
+	}
+
+	// Deleted purchases can't be anomalous.
+	if m.Operation == models.OperationDelete {
+		return nil
+	}
+
 	var msg models.PurchaseMessage
 	if err := models.ParsePayload(m, &msg); err != nil {
-		return fmt.Errorf("parsing purchase message: %w", err)
+		return bus.Permanent(fmt.Errorf("parsing purchase message: %w", err))
 	}
 
-	// Calculate delay between purchase creation and anomaly message received.
-	delay := time.Since(msg.Timestamp)
-	a.delays <- delay
+	// Only rescore updated purchases if their vector has changed.
+	if m.Operation == models.OperationUpdate {
+		var before models.PurchaseMessage
+		if err := models.ParseBefore(m, &before); err != nil {
+			return bus.Permanent(fmt.Errorf("parsing previous purchase message: %w", err))
+		}
 
-	// Fetch distance from database.
-	distance, err := a.fetchDistance(ctx, msg)
+		if slices.Equal(before.Vector, msg.Vector) {
+			return nil
+		}
+	}
+
+	result, err := a.score(ctx, msg)
+	if err != nil {
+		return fmt.Errorf("scoring purchase: %w", err)
+	}
+
+	triggered, err := a.checkRules(ctx, msg)
 	if err != nil {
-		return fmt.Errorf("fetching distance: %w", err)
+		return fmt.Errorf("checking rules: %w", err)
 	}
 
-	// Create anomaly in the database if distance is sufficient.
-	if distance <= 0.3 {
+	// Create anomaly in the database if the score is sufficient or the
+	// purchase broke any rules.
+	if !result.Anomalous() && len(triggered) == 0 {
 		return nil
 	}
 
-	log.Printf("anomalous purchase (distance: %0.3f)", distance)
+	log.Printf("anomalous purchase (%s score against %s baseline: %0.3f, threshold: %0.3f, rules broken: %d)", result.Strategy, result.Baseline, result.Score, result.Threshold, len(triggered))
 
-	if err = a.createAnomaly(ctx, msg, distance); err != nil {
+	if err = a.createAnomaly(ctx, msg, result, triggered); err != nil {
 		return fmt.Errorf("inserting anomaly: %w", err)
 	}
 
 	return nil
 }
 
-func (a *AnomalyDetection) fetchDistance(ctx context.Context, msg models.PurchaseMessage) (float64, error) {
-	const stmt = `SELECT * FROM purchase_distance_from_average($1, $2)`
+func (a *AnomalyDetection) checkRules(ctx context.Context, msg models.PurchaseMessage) ([]rules.Triggered, error) {
+	defer metrics.ObserveQuery(a.Name(), "check_rules", time.Now())
 
-	row := a.d.DB.QueryRowContext(ctx, stmt, msg.ID, msg.CustomerID)
+	return a.rules.Check(ctx, a.d.DB, msg.ID, msg.CustomerID)
+}
 
-	var score float64
-	if err := row.Scan(&score); err != nil {
-		return 0, fmt.Errorf("executing query: %w", err)
-	}
+func (a *AnomalyDetection) score(ctx context.Context, msg models.PurchaseMessage) (scoring.Result, error) {
+	defer metrics.ObserveQuery(a.Name(), "score_purchase", time.Now())
 
-	return score, nil
+	return a.scorer.Score(ctx, a.d.DB, msg)
 }
 
-func (a *AnomalyDetection) createAnomaly(ctx context.Context, msg models.PurchaseMessage, score float64) error {
-	const stmt = `INSERT INTO anomaly (purchase_id, customer_id, score) VALUES ($1, $2, $3)`
+// createAnomaly stores an anomaly along with the rules it broke, so they're
+// available by the time the Reasoning agent receives the anomaly.
+func (a *AnomalyDetection) createAnomaly(ctx context.Context, msg models.PurchaseMessage, result scoring.Result, triggered []rules.Triggered) error {
+	const anomalyStmt = `UPSERT INTO anomaly (purchase_id, customer_id, score, strategy, baseline) VALUES ($1, $2, $3, $4, $5)`
+	const ruleStmt = `UPSERT INTO anomaly_rule (purchase_id, customer_id, rule, type, detail) VALUES ($1, $2, $3, $4, $5)`
+	defer metrics.ObserveQuery(a.Name(), "create_anomaly", time.Now())
 
-	_, err := a.d.DB.ExecContext(ctx, stmt, msg.ID, msg.CustomerID, score)
+	tx, err := a.d.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("executing query: %w", err)
+		return fmt.Errorf("beginning transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	return nil
-}
-
-func (a *AnomalyDetection) log() {
-	var delays []time.Duration
-
-	logTick := time.Tick(time.Second * 1)
-
-	for {
-		select {
-		case d := <-a.delays:
-			delays = append(delays, d)
-
-		case <-logTick:
-			if len(delays) == 0 {
-				continue
-			}
-
-			var total time.Duration
-			for _, d := range delays {
-				total += d
-			}
-
-			log.Printf(
-				"events processed: %d / average delay: %v",
-				len(delays),
-				total/time.Duration(len(delays)),
-			)
+	_, err = tx.ExecContext(ctx, anomalyStmt, msg.ID, msg.CustomerID, result.Score, string(result.Strategy), string(result.Baseline))
+	if err != nil {
+		return fmt.Errorf("executing query: %w", err)
+	}
 
-			delays = []time.Duration{}
+	for _, t := range triggered {
+		if _, err = tx.ExecContext(ctx, ruleStmt, msg.ID, msg.CustomerID, t.Rule, string(t.Type), t.Detail); err != nil {
+			return fmt.Errorf("storing rule %q: %w", t.Rule, err)
 		}
 	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
 }
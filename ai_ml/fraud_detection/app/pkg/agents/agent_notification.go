@@ -2,34 +2,34 @@ package agents
 
 import (
 	"context"
+	"crdb/ai_ml/fraud_detection/app/pkg/bus"
+	"crdb/ai_ml/fraud_detection/app/pkg/metrics"
 	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"crdb/ai_ml/fraud_detection/app/pkg/notify"
+	"errors"
 	"fmt"
 	"log"
-
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/ses"
+	"time"
 )
 
+// notificationSubject is used for channels that support a subject line.
+const notificationSubject = "We've flagged a recent purchase"
+
 type Notification struct {
-	d         *Dependencies
-	snsClient *ses.Client
+	d        *Dependencies
+	notifier notify.Notifier
 }
 
-func NewNotification(d *Dependencies) (*Notification, error) {
-	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(d.Region))
-	if err != nil {
-		return nil, fmt.Errorf("loading default config: %w", err)
-	}
-
+func NewNotification(d *Dependencies, n notify.Notifier) *Notification {
 	return &Notification{
-		d:         d,
-		snsClient: ses.NewFromConfig(cfg),
-	}, nil
+		d:        d,
+		notifier: n,
+	}
 }
 
-// Run blocks forever.
+// Run blocks until the context is cancelled.
 func (a *Notification) Run(ctx context.Context) {
-	c := a.d.Bus.NewConsumer(a.d.Topic)
+	c := a.d.newConsumer(a.Name())
 	c.Run(ctx, a.Process)
 }
 
@@ -38,20 +38,88 @@ func (a *Notification) Name() string {
 }
 
 func (a *Notification) Process(ctx context.Context, m models.Message) error {
+	m, err := a.d.fetchRow(ctx, a.Name(), m, "notification", "purchase_id", "customer_id")
+	if err != nil {
+		return err
+	}
+
+	// Only act on notifications as they become pending, not on deletes or
+	// subsequent updates.
+	pending, err := enteredStatus(m, "pending")
+	if err != nil {
+		return err
+	}
+	if !pending {
+		return nil
+	}
+
 	var msg models.NotificationMessage
 	if err := models.ParsePayload(m, &msg); err != nil {
-		return fmt.Errorf("parsing notification message: %w", err)
+		return bus.Permanent(fmt.Errorf("parsing notification message: %w", err))
 	}
 	log.Printf("notification received")
 
+	return a.deliver(ctx, msg)
+}
+
+// deliver claims a notification by moving it from pending to sending, then
+// sends it without holding any locks, and marks it as sent once the provider
+// has accepted it. A notification that's already sending was claimed by an
+// attempt whose outcome isn't known, so it's sent again with the same
+// idempotency key, the purchase ID, for providers to discard duplicates by.
+func (a *Notification) deliver(ctx context.Context, msg models.NotificationMessage) error {
+	claimed, err := a.claim(ctx, msg)
+	if err != nil {
+		return fmt.Errorf("claiming notification: %w", err)
+	}
+	if !claimed {
+		log.Printf("notification no longer pending, skipping")
+		return nil
+	}
+
 	// Fetch purchase context.
-	context, err := a.fetchContext(ctx, msg)
+	context, err := a.fetchContext(ctx, a.d.DB, msg)
 	if err != nil {
-		return fmt.Errorf("fetching context for reasoning: %w", err)
+		return fmt.Errorf("fetching context for notification: %w", err)
 	}
 	log.Printf("context fetched")
 
-	log.Printf("sending notification: %+v", context)
+	id, sendErr := a.notifier.Send(ctx, notify.Notification{
+		Channel:        notify.Channel(context.channel),
+		Target:         context.target,
+		Subject:        notificationSubject,
+		Message:        context.message,
+		IdempotencyKey: msg.PurchaseID,
+	})
+	if sendErr != nil {
+		if err = a.recordAttempt(ctx, a.d.DB, msg, context, "", sendErr); err != nil {
+			log.Printf("error recording failed attempt: %v", err)
+		}
+
+		if errors.Is(sendErr, notify.ErrUnsupportedChannel) {
+			return bus.Permanent(fmt.Errorf("sending notification: %w", sendErr))
+		}
+		return fmt.Errorf("sending notification: %w", sendErr)
+	}
+	log.Printf("notification sent via %s: %s", context.channel, id)
+
+	tx, err := a.d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err = a.recordAttempt(ctx, tx, msg, context, id, nil); err != nil {
+		return fmt.Errorf("recording attempt: %w", err)
+	}
+
+	if err = a.markSent(ctx, tx, msg); err != nil {
+		return fmt.Errorf("marking notification as sent: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
 
 	return nil
 }
@@ -62,10 +130,32 @@ type notificationContext struct {
 	message string
 }
 
-func (a *Notification) fetchContext(ctx context.Context, msg models.NotificationMessage) (notificationContext, error) {
+// claim marks a pending notification as sending, reporting whether it's
+// pending or already sending. Notifications that have been sent, dismissed or
+// deleted aren't claimed.
+func (a *Notification) claim(ctx context.Context, msg models.NotificationMessage) (bool, error) {
+	const stmt = `UPDATE notification SET status = 'sending'
+		WHERE purchase_id = $1 AND customer_id = $2 AND status IN ('pending', 'sending')`
+	defer metrics.ObserveQuery(a.Name(), "claim_notification", time.Now())
+
+	res, err := a.d.DB.ExecContext(ctx, stmt, msg.PurchaseID, msg.CustomerID)
+	if err != nil {
+		return false, fmt.Errorf("executing query: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("checking rows affected: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+func (a *Notification) fetchContext(ctx context.Context, q queryer, msg models.NotificationMessage) (notificationContext, error) {
 	const stmt = `SELECT channel, target, message FROM fetch_notification_context($1, $2)`
+	defer metrics.ObserveQuery(a.Name(), "fetch_notification_context", time.Now())
 
-	row := a.d.DB.QueryRowContext(ctx, stmt, msg.PurchaseID, msg.CustomerID)
+	row := q.QueryRowContext(ctx, stmt, msg.PurchaseID, msg.CustomerID)
 
 	var nc notificationContext
 	if err := row.Scan(&nc.channel, &nc.target, &nc.message); err != nil {
@@ -74,3 +164,31 @@ func (a *Notification) fetchContext(ctx context.Context, msg models.Notification
 
 	return nc, nil
 }
+
+func (a *Notification) recordAttempt(ctx context.Context, q queryer, msg models.NotificationMessage, nc notificationContext, providerMessageID string, sendErr error) error {
+	const stmt = `INSERT INTO notification_attempt (purchase_id, customer_id, channel, target, provider_message_id, error)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''))`
+	defer metrics.ObserveQuery(a.Name(), "record_notification_attempt", time.Now())
+
+	var errMsg string
+	if sendErr != nil {
+		errMsg = sendErr.Error()
+	}
+
+	if _, err := q.ExecContext(ctx, stmt, msg.PurchaseID, msg.CustomerID, nc.channel, nc.target, providerMessageID, errMsg); err != nil {
+		return fmt.Errorf("executing query: %w", err)
+	}
+
+	return nil
+}
+
+func (a *Notification) markSent(ctx context.Context, q queryer, msg models.NotificationMessage) error {
+	const stmt = `UPDATE notification SET status = 'sent' WHERE purchase_id = $1 AND customer_id = $2 AND status = 'sending'`
+	defer metrics.ObserveQuery(a.Name(), "mark_notification_sent", time.Now())
+
+	if _, err := q.ExecContext(ctx, stmt, msg.PurchaseID, msg.CustomerID); err != nil {
+		return fmt.Errorf("executing query: %w", err)
+	}
+
+	return nil
+}
@@ -1,27 +1,64 @@
 package agents
 
 import (
+	"cmp"
 	"context"
+	"crdb/ai_ml/fraud_detection/app/pkg/bus"
+	"crdb/ai_ml/fraud_detection/app/pkg/llm"
+	"crdb/ai_ml/fraud_detection/app/pkg/metrics"
 	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"crdb/ai_ml/fraud_detection/app/pkg/prompt"
+	"crdb/ai_ml/fraud_detection/app/pkg/review"
+	"crdb/ai_ml/fraud_detection/app/pkg/scoring"
+	"crdb/ai_ml/fraud_detection/app/pkg/vectorize"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-
-	"github.com/openai/openai-go/v3"
+	"math"
+	"strings"
+	"time"
 )
 
+// ReasoningConfig configures how the Reasoning agent gets assessments.
+type ReasoningConfig struct {
+	// Attempts is how many times to ask for an assessment before giving up on
+	// invalid responses.
+	Attempts int
+
+	// Cache holds assessments for reuse by anomalies whose contributions are
+	// the same when rounded to the nearest CacheRounding percentage points,
+	// and that broke the same rules. A nil Cache disables caching.
+	Cache         *llm.Cache
+	CacheRounding float64
+
+	// ReviewRequired holds notifications until an analyst approves them or
+	// confirms the anomaly as fraud.
+	ReviewRequired bool
+}
+
 type Reasoning struct {
-	d *Dependencies
+	d        *Dependencies
+	prompter *prompt.Prompter
+	cfg      ReasoningConfig
 }
 
-func NewReasoning(d *Dependencies) *Reasoning {
+func NewReasoning(d *Dependencies, prompter *prompt.Prompter, cfg ReasoningConfig) *Reasoning {
+	cfg.Attempts = max(cfg.Attempts, 1)
+
 	return &Reasoning{
-		d: d,
+		d:        d,
+		prompter: prompter,
+		cfg:      cfg,
 	}
 }
 
-// Run blocks forever.
+// Run blocks until the context is cancelled.
 func (a *Reasoning) Run(ctx context.Context) {
-	c := a.d.Bus.NewConsumer(a.d.Topic)
+	go a.prompter.Watch(ctx)
+
+	c := a.d.newConsumer(a.Name())
 	c.Run(ctx, a.Process)
 }
 
@@ -30,27 +67,80 @@ func (a *Reasoning) Name() string {
 }
 
 func (a *Reasoning) Process(ctx context.Context, m models.Message) error {
+	m, err := a.d.fetchRow(ctx, a.Name(), m, "anomaly", "purchase_id", "customer_id")
+	if err != nil {
+		return err
+	}
+
+	// Only act on anomalies as they become pending, not on deletes or
+	// subsequent updates.
+	pending, err := enteredStatus(m, "pending")
+	if err != nil {
+		return err
+	}
+	if !pending {
+		return nil
+	}
+
 	var msg models.AnomalyMessage
 	if err := models.ParsePayload(m, &msg); err != nil {
-		return fmt.Errorf("parsing anomaly message: %w", err)
+		return bus.Permanent(fmt.Errorf("parsing anomaly message: %w", err))
 	}
 	log.Printf("anomaly received")
 
+	// A replayed message may be for an anomaly that's already been reasoned
+	// about. This is checked again when storing the result, but checking
+	// first avoids most unnecessary LLM requests.
+	state, err := a.fetchState(ctx, a.d.DB, msg, false)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Printf("anomaly no longer exists, skipping")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("fetching anomaly status: %w", err)
+	}
+	if state.status == "processed" {
+		log.Printf("anomaly already processed, skipping")
+		return nil
+	}
+
+	// There's nothing to tell the customer about an anomaly that an analyst
+	// has already dismissed.
+	if state.review == string(review.OutcomeDismissed) {
+		log.Printf("anomaly dismissed by an analyst, skipping")
+		return a.complete(ctx, models.Assessment{}, "", msg)
+	}
+
 	// Fetch purchase context.
-	context, err := a.fetchContext(ctx, msg)
+	context, rules, err := a.fetchContext(ctx, msg)
 	if err != nil {
 		return fmt.Errorf("fetching context for reasoning: %w", err)
 	}
 	log.Printf("purchase context fetched")
 
-	resp, err := a.performLLMRequest(context.String())
+	version, rendered, err := a.prompter.Render(msg.PurchaseID, context)
+	if err != nil {
+		return bus.Permanent(fmt.Errorf("rendering prompt: %w", err))
+	}
+
+	assessment, err := a.cachedAssess(ctx, a.cacheKey(version, context, rules), rendered)
+
+	// Wait out rate limits and provider outages rather than using up the
+	// message's attempts, and give up on requests the provider rejects.
+	var unavailable *llm.UnavailableError
+	if errors.As(err, &unavailable) {
+		return bus.Defer(fmt.Errorf("performing reasoning: %w", err), unavailable.RetryAfter)
+	}
+	if errors.Is(err, llm.ErrRejected) {
+		return bus.Permanent(fmt.Errorf("performing reasoning: %w", err))
+	}
 	if err != nil {
 		return fmt.Errorf("performing reasoning: %w", err)
 	}
-	log.Printf("llm response received")
+	log.Printf("llm response received (prompt: %s, action: %s, confidence: %0.2f)", version, assessment.Action, assessment.Confidence)
 
 	// Store the response alongside the anomaly.
-	if err = a.storeNotification(ctx, resp, msg); err != nil {
+	if err = a.complete(ctx, assessment, version, msg); err != nil {
 		return fmt.Errorf("storing reasoning: %w", err)
 	}
 	log.Printf("llm response stored")
@@ -58,95 +148,314 @@ func (a *Reasoning) Process(ctx context.Context, m models.Message) error {
 	return nil
 }
 
-type llmContext struct {
-	purchaseID            string
-	amountContribution    float64
-	hourOfDayContribution float64
-	locationContribution  float64
-}
-
-func (ctx llmContext) String() string {
-	const messageFormat = `A customer purchase (id: %s) has been deemed to be
-												 anomalous.
-
-												 Compose a very brief message to them explaining why
-												 their purchase has been flagged, sharing just the
-												 primary reason for the flagging (in a clear and human
-												 way; nothing too formal and don't use business or
-												 technical lingo):
-												 
-												 For context, here are the things that contributed to
-												 the detection:
-
-												 - Purchase amount contributed %.4f to the detection
-												 - Time of day contributed %.4f to the detection
-												 - Location contributed %.4f to the detection
-												 
-												 Our company name is "ACME Corp."
-												 Don't use a placeholder for their name.`
-
-	return fmt.Sprintf(
-		ctx.purchaseID,
-		messageFormat,
-		ctx.amountContribution,
-		ctx.hourOfDayContribution,
-		ctx.locationContribution,
+// complete stores the notification and marks the anomaly as processed in one
+// transaction, unless another attempt has processed it in the meantime. The
+// notification is held for review if reviews are required and an analyst
+// hasn't already reviewed the anomaly, and isn't stored at all if they've
+// dismissed it.
+func (a *Reasoning) complete(ctx context.Context, assessment models.Assessment, version string, msg models.AnomalyMessage) error {
+	tx, err := a.d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	state, err := a.fetchState(ctx, tx, msg, true)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("locking anomaly: %w", err)
+	}
+	if state.status == "processed" {
+		log.Printf("anomaly processed concurrently, discarding response")
+		return nil
+	}
+
+	if state.review != string(review.OutcomeDismissed) {
+		status := "pending"
+		if a.cfg.ReviewRequired && state.review == "" {
+			status = "review"
+		}
+
+		if err = a.storeNotification(ctx, tx, assessment, version, status, msg); err != nil {
+			return fmt.Errorf("storing notification: %w", err)
+		}
+	}
+
+	if err = a.markProcessed(ctx, tx, msg); err != nil {
+		return fmt.Errorf("marking anomaly as processed: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// cachedAssess returns the cached assessment for the key if there is one, or
+// otherwise asks for one and caches it.
+func (a *Reasoning) cachedAssess(ctx context.Context, key, prompt string) (models.Assessment, error) {
+	if a.cfg.Cache == nil {
+		return a.assess(ctx, prompt)
+	}
+
+	if resp, ok := a.cfg.Cache.Get(key); ok {
+		metrics.LLMCacheLookups.WithLabelValues(a.Name(), "hit").Inc()
+		return models.ParseAssessment(resp)
+	}
+	metrics.LLMCacheLookups.WithLabelValues(a.Name(), "miss").Inc()
+
+	assessment, err := a.assess(ctx, prompt)
+	if err != nil {
+		return models.Assessment{}, err
+	}
+
+	resp, err := json.Marshal(assessment)
+	if err != nil {
+		return models.Assessment{}, fmt.Errorf("encoding assessment: %w", err)
+	}
+	a.cfg.Cache.Add(key, string(resp))
+
+	return assessment, nil
+}
+
+// cacheKey identifies the anomalies that can share an assessment: those
+// rendered from the same template for the same locale, whose contributions
+// are the same when rounded to the nearest CacheRounding percentage points,
+// and that broke the same rules.
+func (a *Reasoning) cacheKey(version string, data prompt.Data, rules []string) string {
+	round := func(v float64) float64 {
+		if a.cfg.CacheRounding <= 0 {
+			return v
+		}
+		return math.Round(v/a.cfg.CacheRounding) * a.cfg.CacheRounding
+	}
+
+	return fmt.Sprintf("%s|%s|%g|%g|%g|%s",
+		version,
+		a.prompter.Locale(data.Locale),
+		round(data.AmountContribution),
+		round(data.HourOfDayContribution),
+		round(data.LocationContribution),
+		strings.Join(rules, "|"),
 	)
 }
 
-func (a *Reasoning) performLLMRequest(prompt string) (string, error) {
-	chatCompletion, err := a.d.LLM.Chat.Completions.New(context.Background(), openai.ChatCompletionNewParams{
-		Messages: []openai.ChatCompletionMessageParamUnion{
-			openai.UserMessage(prompt),
-		},
-		Model: openai.ChatModelGPT4o,
-	})
+// assess asks the LLM for an assessment of the anomaly, asking again if the
+// response doesn't match the schema.
+func (a *Reasoning) assess(ctx context.Context, prompt string) (models.Assessment, error) {
+	var invalid error
+	for attempt := 1; attempt <= a.cfg.Attempts; attempt++ {
+		p := prompt
+		if invalid != nil {
+			p += fmt.Sprintf("\n\nYour previous response was invalid (%v). Respond with only the JSON object.", invalid)
+		}
+
+		resp, err := a.performLLMRequest(ctx, p)
+		if err != nil {
+			return models.Assessment{}, err
+		}
 
-	if len(chatCompletion.Choices) == 0 {
-		return "", fmt.Errorf("empty chat completion")
+		assessment, err := models.ParseAssessment(resp)
+		if err == nil {
+			return assessment, nil
+		}
+
+		metrics.LLMInvalidResponses.WithLabelValues(a.Name()).Inc()
+		log.Printf("invalid llm response (attempt %d of %d): %v", attempt, a.cfg.Attempts, err)
+		invalid = err
 	}
 
-	return chatCompletion.Choices[0].Message.Content, err
+	return models.Assessment{}, fmt.Errorf("no valid response after %d attempts: %w", a.cfg.Attempts, invalid)
 }
 
-func (a *Reasoning) fetchContext(ctx context.Context, msg models.AnomalyMessage) (llmContext, error) {
-	const stmt = `SELECT dimension_name, contribution_pct FROM purchase_distance_breakdown($1, $2)`
+func (a *Reasoning) performLLMRequest(ctx context.Context, prompt string) (string, error) {
+	defer metrics.ObserveLLM(a.Name(), time.Now())
 
-	rows, err := a.d.DB.QueryContext(ctx, stmt, msg.PurchaseID, msg.CustomerID)
+	schema := llm.Schema{Name: "assessment", Schema: models.AssessmentSchema}
+
+	resp, err := a.d.LLM.CompleteJSON(ctx, prompt, schema)
 	if err != nil {
-		return llmContext{}, fmt.Errorf("making query: %w", err)
+		return "", fmt.Errorf("completing prompt: %w", err)
 	}
 
-	var name string
-	var percent float64
-	context := llmContext{
-		purchaseID: msg.PurchaseID,
+	return resp, nil
+}
+
+// fetchContext returns the data to render the anomaly's prompt with, and the
+// names of the rules the purchase broke.
+func (a *Reasoning) fetchContext(ctx context.Context, msg models.AnomalyMessage) (prompt.Data, []string, error) {
+	context := prompt.Data{
+		PurchaseID: msg.PurchaseID,
 	}
 
-	for rows.Next() {
-		if err = rows.Scan(&name, &percent); err != nil {
-			return llmContext{}, fmt.Errorf("scanning row: %w", err)
+	breakdown, err := a.fetchBreakdown(ctx, msg)
+	if err != nil {
+		return prompt.Data{}, nil, fmt.Errorf("fetching breakdown: %w", err)
+	}
+
+	for _, c := range breakdown {
+		switch c.Dimension {
+		case vectorize.Amount.Name:
+			context.AmountContribution = c.Percent
+
+		case vectorize.HourOfDay.Name:
+			context.HourOfDayContribution = c.Percent
+
+		case vectorize.Location.Name:
+			context.LocationContribution = c.Percent
 		}
+	}
+
+	rules, details, err := a.fetchRules(ctx, msg)
+	if err != nil {
+		return prompt.Data{}, nil, fmt.Errorf("fetching broken rules: %w", err)
+	}
+	context.Rules = details
+
+	if context.Locale, err = a.fetchLocale(ctx, msg); err != nil {
+		return prompt.Data{}, nil, fmt.Errorf("fetching customer locale: %w", err)
+	}
+
+	return context, rules, nil
+}
+
+// fetchBreakdown returns how much each dimension of the purchase's vector
+// contributed to its distance from the average of the baseline it was
+// detected with, as it was when the purchase was made.
+func (a *Reasoning) fetchBreakdown(ctx context.Context, msg models.AnomalyMessage) ([]vectorize.Contribution, error) {
+	const stmt = `SELECT p.vec::STRING, baseline_average($2, $3, p.ts)::STRING
+		FROM purchase p
+		WHERE p.id = $1`
+	defer metrics.ObserveQuery(a.Name(), "baseline_average", time.Now())
+
+	// Explain the anomaly against the baseline it was detected with.
+	// Anomalies from before baselines were recorded used the customer's.
+	baseline := cmp.Or(msg.Baseline, string(scoring.BaselineCustomer))
+
+	var vec, average sql.NullString
+	err := a.d.DB.QueryRowContext(ctx, stmt, msg.PurchaseID, msg.CustomerID, baseline).Scan(&vec, &average)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The purchase has since been deleted.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("making query: %w", err)
+	}
+
+	// There's nothing to explain a purchase against an empty baseline with.
+	if !vec.Valid || !average.Valid {
+		return nil, nil
+	}
+
+	v, err := models.ParseVector(vec.String)
+	if err != nil {
+		return nil, fmt.Errorf("parsing purchase vector: %w", err)
+	}
+
+	avg, err := models.ParseVector(average.String)
+	if err != nil {
+		return nil, fmt.Errorf("parsing baseline average: %w", err)
+	}
+
+	if len(v) != vectorize.Size() || len(avg) != vectorize.Size() {
+		return nil, fmt.Errorf("vectors have %d and %d elements rather than %d", len(v), len(avg), vectorize.Size())
+	}
+
+	return vectorize.Breakdown(v, avg), nil
+}
+
+// fetchLocale returns the locale to write the customer's message in.
+func (a *Reasoning) fetchLocale(ctx context.Context, msg models.AnomalyMessage) (string, error) {
+	const stmt = `SELECT locale FROM customer WHERE id = $1`
+	defer metrics.ObserveQuery(a.Name(), "fetch_customer_locale", time.Now())
+
+	var locale string
+	if err := a.d.DB.QueryRowContext(ctx, stmt, msg.CustomerID).Scan(&locale); err != nil {
+		return "", fmt.Errorf("making query: %w", err)
+	}
+
+	return locale, nil
+}
 
-		switch name {
-		case "amount":
-			context.amountContribution = percent
+// fetchRules returns the name and a description of each rule the purchase
+// broke.
+func (a *Reasoning) fetchRules(ctx context.Context, msg models.AnomalyMessage) ([]string, []string, error) {
+	const stmt = `SELECT rule, detail FROM anomaly_rule WHERE purchase_id = $1 AND customer_id = $2 ORDER BY rule`
+	defer metrics.ObserveQuery(a.Name(), "fetch_anomaly_rules", time.Now())
 
-		case "hour_of_day":
-			context.hourOfDayContribution = percent
+	rows, err := a.d.DB.QueryContext(ctx, stmt, msg.PurchaseID, msg.CustomerID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("making query: %w", err)
+	}
+	defer rows.Close()
 
-		case "location":
-			context.locationContribution = percent
+	var names, details []string
+	for rows.Next() {
+		var name, detail string
+		if err = rows.Scan(&name, &detail); err != nil {
+			return nil, nil, fmt.Errorf("scanning row: %w", err)
 		}
+		names = append(names, name)
+		details = append(details, detail)
+	}
+
+	return names, details, rows.Err()
+}
+
+type anomalyState struct {
+	status string
+	review string
+}
+
+// fetchState returns an anomaly's status and review outcome, locking its row
+// until the end of the transaction if forUpdate is set.
+func (a *Reasoning) fetchState(ctx context.Context, q queryer, msg models.AnomalyMessage, forUpdate bool) (anomalyState, error) {
+	stmt := `SELECT status, COALESCE(review::STRING, '') FROM anomaly WHERE purchase_id = $1 AND customer_id = $2`
+	if forUpdate {
+		stmt += ` FOR UPDATE`
+	}
+	defer metrics.ObserveQuery(a.Name(), "fetch_anomaly_status", time.Now())
+
+	var state anomalyState
+	if err := q.QueryRowContext(ctx, stmt, msg.PurchaseID, msg.CustomerID).Scan(&state.status, &state.review); err != nil {
+		return anomalyState{}, err
+	}
+
+	return state, nil
+}
+
+func (a *Reasoning) markProcessed(ctx context.Context, q queryer, msg models.AnomalyMessage) error {
+	const stmt = `UPDATE anomaly SET status = 'processed' WHERE purchase_id = $1 AND customer_id = $2`
+	defer metrics.ObserveQuery(a.Name(), "mark_anomaly_processed", time.Now())
+
+	if _, err := q.ExecContext(ctx, stmt, msg.PurchaseID, msg.CustomerID); err != nil {
+		return fmt.Errorf("executing query: %w", err)
 	}
 
-	return context, nil
+	return nil
 }
 
-func (a *Reasoning) storeNotification(ctx context.Context, resp string, msg models.AnomalyMessage) error {
-	const stmt = `INSERT INTO notification (purchase_id, customer_id, reasoning) VALUES ($1, $2, $3)`
+// storeNotification stores the assessment, with its message as the reasoning
+// sent to the customer, and the version of the prompt that produced it.
+func (a *Reasoning) storeNotification(ctx context.Context, q queryer, assessment models.Assessment, version, status string, msg models.AnomalyMessage) error {
+	const stmt = `INSERT INTO notification (purchase_id, customer_id, reasoning, primary_reason, confidence, action, prompt_version, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	defer metrics.ObserveQuery(a.Name(), "store_notification", time.Now())
 
-	if _, err := a.d.DB.ExecContext(ctx, stmt, msg.PurchaseID, msg.CustomerID, resp); err != nil {
+	_, err := q.ExecContext(ctx, stmt,
+		msg.PurchaseID,
+		msg.CustomerID,
+		assessment.Message,
+		assessment.PrimaryReason,
+		assessment.Confidence,
+		string(assessment.Action),
+		version,
+		status,
+	)
+	if err != nil {
 		return fmt.Errorf("executing query: %w", err)
 	}
 
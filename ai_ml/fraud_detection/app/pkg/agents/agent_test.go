@@ -0,0 +1,137 @@
+package agents
+
+import (
+	"context"
+	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"crdb/ai_ml/fraud_detection/app/pkg/notify"
+	"crdb/ai_ml/fraud_detection/app/pkg/prompt"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnteredStatus(t *testing.T) {
+	pending := models.Message{Operation: models.OperationInsert, Payload: []byte(`{"status": "pending"}`)}
+	entered, err := enteredStatus(pending, "pending")
+	assert.NoError(t, err)
+	assert.True(t, entered)
+
+	deleted := models.Message{Operation: models.OperationDelete}
+	entered, err = enteredStatus(deleted, "pending")
+	assert.NoError(t, err)
+	assert.False(t, entered)
+
+	// Messages without a row that aren't deletes, such as key_only messages
+	// that haven't been looked up, fail rather than being skipped.
+	unknown := models.Message{Operation: models.OperationUnknown}
+	_, err = enteredStatus(unknown, "pending")
+	assert.Error(t, err)
+}
+
+func TestCacheKey(t *testing.T) {
+	prompter, err := prompt.NewPrompter(prompt.Default(), prompt.Config{Version: "v1"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	a := NewReasoning(&Dependencies{}, prompter, ReasoningConfig{CacheRounding: 5})
+
+	data := prompt.Data{
+		PurchaseID:         "p1",
+		AmountContribution: 61,
+		Rules:              []string{"3 purchases in the last minute"},
+		Locale:             "FR",
+	}
+	key := a.cacheKey("v1", data, []string{"velocity"})
+
+	// Purchase-specific details don't change the key, and nor do locales
+	// that resolve to the same one.
+	other := data
+	other.PurchaseID = "p2"
+	other.AmountContribution = 59
+	other.Rules = []string{"4 purchases in the last minute"}
+	other.Locale = "fr"
+	assert.Equal(t, key, a.cacheKey("v1", other, []string{"velocity"}))
+
+	// Invalid locales use the fallback locale.
+	other.Locale = "not a locale"
+	assert.Equal(t, a.cacheKey("v1", other, nil), a.cacheKey("v1", prompt.Data{AmountContribution: 60, Locale: "en"}, nil))
+
+	// Different rules do.
+	assert.NotEqual(t, key, a.cacheKey("v1", data, []string{"amount_cap", "velocity"}))
+}
+
+// recordingNotifier records the notifications it's asked to send.
+type recordingNotifier struct {
+	sent []notify.Notification
+}
+
+func (n *recordingNotifier) Send(_ context.Context, notification notify.Notification) (string, error) {
+	n.sent = append(n.sent, notification)
+	return "message-1", nil
+}
+
+// TestKeyOnly checks that a notification is looked up and sent when its
+// message comes from a key_only changefeed. It needs a database with the
+// schema in place, and removes the rows it creates.
+func TestKeyOnly(t *testing.T) {
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		t.Skip("DATABASE_URL isn't set")
+	}
+
+	db, err := sql.Open("pgx", url)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	var customerID, purchaseID string
+	err = db.QueryRowContext(ctx, `INSERT INTO customer (email) VALUES ('key-only@example.com') RETURNING id`).Scan(&customerID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.ExecContext(ctx, `CALL delete_customer_data($1)`, customerID)
+
+	err = db.QueryRowContext(ctx, `INSERT INTO purchase (customer_id, amount, location) VALUES ($1, 10, ST_MakePoint(0, 51.5)::GEOGRAPHY) RETURNING id`, customerID).Scan(&purchaseID)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	const notificationStmt = `INSERT INTO notification (purchase_id, customer_id, reasoning, primary_reason, confidence, action, prompt_version)
+		VALUES ($1, $2, 'Was this you?', 'far from home', 0.8, 'verify', 'v1')`
+	if _, err = db.ExecContext(ctx, notificationStmt, purchaseID, customerID); !assert.NoError(t, err) {
+		return
+	}
+
+	key := []byte(`["` + purchaseID + `", "` + customerID + `"]`)
+	m, err := models.DecodeChangefeed(models.EnvelopeKeyOnly, "notification", key, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	notifier := &recordingNotifier{}
+	agent := NewNotification(NewDependencies(nil, db, nil, "", "notification"), notifier)
+
+	assert.NoError(t, agent.Process(ctx, m))
+	if assert.Len(t, notifier.sent, 1) {
+		assert.Equal(t, "key-only@example.com", notifier.sent[0].Target)
+		assert.Equal(t, "Was this you?", notifier.sent[0].Message)
+	}
+
+	var status string
+	err = db.QueryRowContext(ctx, `SELECT status FROM notification WHERE purchase_id = $1 AND customer_id = $2`, purchaseID, customerID).Scan(&status)
+	assert.NoError(t, err)
+	assert.Equal(t, "sent", status)
+
+	// A key_only message for a row that's since been deleted is skipped.
+	if _, err = db.ExecContext(ctx, `CALL delete_customer_data($1)`, customerID); !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, agent.Process(ctx, m))
+	assert.Len(t, notifier.sent, 1)
+}
@@ -0,0 +1,142 @@
+package backtest
+
+import (
+	"crdb/ai_ml/fraud_detection/app/pkg/scoring"
+	"maps"
+	"slices"
+)
+
+// Sample is a replayed purchase: how it scored, how many rules it broke, and
+// whether it was fraudulent.
+type Sample struct {
+	PurchaseID  string
+	CustomerID  string
+	Result      scoring.Result
+	RulesBroken int
+	Fraud       bool
+}
+
+// alerted reports whether the anomaly detection agent would flag the sample
+// at the given threshold. Breaking a rule flags a purchase at any threshold.
+func (s Sample) alerted(threshold float64) bool {
+	return s.RulesBroken > 0 || s.Result.Score > threshold
+}
+
+// Row is how a threshold would have performed. Configured rows use each
+// sample's own threshold, as the agent would today.
+type Row struct {
+	Strategy       scoring.Name
+	Threshold      float64
+	Configured     bool
+	Purchases      int
+	Alerts         int
+	TruePositives  int
+	FalsePositives int
+	FalseNegatives int
+}
+
+// Precision is the share of alerts that were fraud.
+func (r Row) Precision() float64 {
+	return ratio(r.TruePositives, r.Alerts)
+}
+
+// Recall is the share of fraud that was alerted on.
+func (r Row) Recall() float64 {
+	return ratio(r.TruePositives, r.TruePositives+r.FalseNegatives)
+}
+
+// AlertRate is the share of purchases that were alerted on.
+func (r Row) AlertRate() float64 {
+	return ratio(r.Alerts, r.Purchases)
+}
+
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+
+	return float64(n) / float64(d)
+}
+
+// ByStrategy groups samples by the strategy that scored them, as each
+// strategy's scores are on a different scale.
+func ByStrategy(samples []Sample) map[scoring.Name][]Sample {
+	groups := map[scoring.Name][]Sample{}
+	for _, s := range samples {
+		groups[s.Result.Strategy] = append(groups[s.Result.Strategy], s)
+	}
+
+	return groups
+}
+
+// Thresholds returns steps thresholds spread evenly from the lowest score to
+// just below the highest, so the last still alerts on something.
+func Thresholds(samples []Sample, steps int) []float64 {
+	if len(samples) == 0 || steps <= 0 {
+		return nil
+	}
+
+	lowest, highest := samples[0].Result.Score, samples[0].Result.Score
+	for _, s := range samples[1:] {
+		lowest = min(lowest, s.Result.Score)
+		highest = max(highest, s.Result.Score)
+	}
+
+	if lowest == highest {
+		return []float64{lowest}
+	}
+
+	step := (highest - lowest) / float64(steps)
+
+	thresholds := make([]float64, steps)
+	for i := range thresholds {
+		thresholds[i] = lowest + step*float64(i)
+	}
+
+	return thresholds
+}
+
+// Evaluate reports how the configured thresholds performed for samples scored
+// with the same strategy, followed by each of the given thresholds.
+func Evaluate(samples []Sample, thresholds []float64) []Row {
+	var strategy scoring.Name
+	if len(samples) > 0 {
+		strategy = samples[0].Result.Strategy
+	}
+
+	configured := Row{Strategy: strategy, Configured: true}
+	for _, s := range samples {
+		configured.add(s, s.alerted(s.Result.Threshold))
+	}
+
+	rows := []Row{configured}
+	for _, t := range slices.Sorted(slices.Values(thresholds)) {
+		r := Row{Strategy: strategy, Threshold: t}
+		for _, s := range samples {
+			r.add(s, s.alerted(t))
+		}
+		rows = append(rows, r)
+	}
+
+	return rows
+}
+
+func (r *Row) add(s Sample, alerted bool) {
+	r.Purchases++
+
+	switch {
+	case alerted && s.Fraud:
+		r.Alerts++
+		r.TruePositives++
+	case alerted:
+		r.Alerts++
+		r.FalsePositives++
+	case s.Fraud:
+		r.FalseNegatives++
+	}
+}
+
+// Strategies returns the strategies in groups, in name order.
+func Strategies(groups map[scoring.Name][]Sample) []scoring.Name {
+	return slices.Sorted(maps.Keys(groups))
+}
@@ -0,0 +1,91 @@
+package backtest
+
+import (
+	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"crdb/ai_ml/fraud_detection/app/pkg/scoring"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sample(score float64, rulesBroken int, fraud bool) Sample {
+	return Sample{
+		Result: scoring.Result{
+			Strategy:  scoring.NameL2,
+			Score:     score,
+			Threshold: 0.5,
+		},
+		RulesBroken: rulesBroken,
+		Fraud:       fraud,
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	samples := []Sample{
+		sample(0.9, 0, true),
+		sample(0.6, 0, false),
+		sample(0.4, 0, true),
+		sample(0.2, 1, true),
+		sample(0.1, 0, false),
+	}
+
+	rows := Evaluate(samples, []float64{0.7, 0.3})
+
+	exp := []Row{
+		{Strategy: scoring.NameL2, Configured: true, Purchases: 5, Alerts: 3, TruePositives: 2, FalsePositives: 1, FalseNegatives: 1},
+		{Strategy: scoring.NameL2, Threshold: 0.3, Purchases: 5, Alerts: 4, TruePositives: 3, FalsePositives: 1},
+		{Strategy: scoring.NameL2, Threshold: 0.7, Purchases: 5, Alerts: 2, TruePositives: 2, FalseNegatives: 1},
+	}
+	assert.Equal(t, exp, rows)
+
+	assert.InDelta(t, 2.0/3, rows[0].Precision(), 0.0001)
+	assert.InDelta(t, 2.0/3, rows[0].Recall(), 0.0001)
+	assert.InDelta(t, 0.6, rows[0].AlertRate(), 0.0001)
+
+	assert.Equal(t, 0.0, Row{}.Precision())
+}
+
+func TestThresholds(t *testing.T) {
+	samples := []Sample{sample(0.4, 0, false), sample(0.2, 0, false), sample(1.2, 0, false)}
+
+	assert.InDeltaSlice(t, []float64{0.2, 0.45, 0.7, 0.95}, Thresholds(samples, 4), 0.0001)
+	assert.Equal(t, []float64{0.2}, Thresholds(samples[1:2], 4))
+	assert.Nil(t, Thresholds(nil, 4))
+}
+
+func TestByStrategy(t *testing.T) {
+	zScore := sample(3, 0, false)
+	zScore.Result.Strategy = scoring.NameZScore
+
+	groups := ByStrategy([]Sample{sample(0.1, 0, false), zScore, sample(0.2, 0, false)})
+
+	assert.Equal(t, []scoring.Name{scoring.NameL2, scoring.NameZScore}, Strategies(groups))
+	assert.Len(t, groups[scoring.NameL2], 2)
+	assert.Len(t, groups[scoring.NameZScore], 1)
+}
+
+func TestReadDump(t *testing.T) {
+	dump := strings.Join([]string{
+		`{"after": {"id": "p1", "customer_id": "c1", "amount": 10, "vec": "[1,2]"}, "updated": "1.0"}`,
+		`{"resolved": "2.0"}`,
+		``,
+		`{"after": {"id": "p2", "customer_id": "c1", "amount": 20, "vec": "[3,4]"}}`,
+		`{"after": {"id": "p1", "customer_id": "c1", "amount": 15, "vec": "[5,6]"}, "before": {"id": "p1"}}`,
+		`{"after": null, "before": {"id": "p2"}}`,
+		`{"after": {"id": "p3", "customer_id": "c2", "amount": 9, "ts": "2025-01-01T00:00:00Z", "location": {"type": "Point", "coordinates": [0, 0]}}}`,
+	}, "\n")
+
+	purchases, err := ReadDump(strings.NewReader(dump), models.EnvelopeWrapped)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []models.PurchaseMessage{
+		{ID: "p1", CustomerID: "c1", Amount: 15, Vector: models.VectorString{5, 6}},
+		{ID: "p2", CustomerID: "c1", Amount: 20, Vector: models.VectorString{3, 4}},
+		{ID: "p3", CustomerID: "c2", Amount: 9, Timestamp: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), Location: &models.LatLon{}, Vector: models.VectorString{0.35, 0, 1, 0, 0}},
+	}, purchases)
+
+	_, err = ReadDump(strings.NewReader("not json"), models.EnvelopeWrapped)
+	assert.Error(t, err)
+}
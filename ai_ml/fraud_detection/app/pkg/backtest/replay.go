@@ -0,0 +1,100 @@
+package backtest
+
+import (
+	"context"
+	"crdb/ai_ml/fraud_detection/app/pkg/feedback"
+	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"crdb/ai_ml/fraud_detection/app/pkg/rules"
+	"crdb/ai_ml/fraud_detection/app/pkg/scoring"
+	"database/sql"
+	"fmt"
+)
+
+// Replayer scores purchases the way the anomaly detection agent does, but
+// in read-only transactions, so nothing is written.
+//
+// Purchases must be in the database, as scoring and rules look them up by ID.
+// Like the agent, they're only compared against purchases made before them,
+// but labels are as they are now, so fraud that's been confirmed since is
+// left out of baselines and false positive rates include later feedback.
+type Replayer struct {
+	db     *sql.DB
+	scorer *scoring.Scorer
+	rules  *rules.Engine
+}
+
+func NewReplayer(db *sql.DB, scorer *scoring.Scorer, rules *rules.Engine) *Replayer {
+	return &Replayer{
+		db:     db,
+		scorer: scorer,
+		rules:  rules,
+	}
+}
+
+// Replay scores a purchase and checks it against the rules, labelling it as
+// fraud if the workload injected it as fraud or its anomaly has been
+// confirmed as fraud.
+func (r *Replayer) Replay(ctx context.Context, p models.PurchaseMessage) (Sample, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return Sample{}, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err = checkExists(ctx, tx, p); err != nil {
+		return Sample{}, err
+	}
+
+	result, err := r.scorer.Score(ctx, tx, p)
+	if err != nil {
+		return Sample{}, fmt.Errorf("scoring purchase: %w", err)
+	}
+
+	triggered, err := r.rules.Check(ctx, tx, p.ID, p.CustomerID)
+	if err != nil {
+		return Sample{}, fmt.Errorf("checking rules: %w", err)
+	}
+
+	fraud, err := fetchLabel(ctx, tx, p)
+	if err != nil {
+		return Sample{}, fmt.Errorf("fetching label: %w", err)
+	}
+
+	return Sample{
+		PurchaseID:  p.ID,
+		CustomerID:  p.CustomerID,
+		Result:      result,
+		RulesBroken: len(triggered),
+		Fraud:       fraud,
+	}, nil
+}
+
+// checkExists fails if a purchase isn't in the database, such as one from a
+// dump of another cluster's purchase topic, rather than letting it score 0.
+func checkExists(ctx context.Context, tx *sql.Tx, p models.PurchaseMessage) error {
+	const stmt = `SELECT EXISTS (SELECT 1 FROM purchase WHERE id = $1 AND customer_id = $2)`
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, stmt, p.ID, p.CustomerID).Scan(&exists); err != nil {
+		return fmt.Errorf("checking purchase exists: %w", err)
+	}
+
+	if !exists {
+		return fmt.Errorf("purchase %s isn't in the database, so can't be replayed", p.ID)
+	}
+
+	return nil
+}
+
+// fetchLabel reports whether a purchase was fraud: either injected as fraud
+// by the workload, or confirmed as fraud since. Purchases that weren't
+// flagged, or haven't been labelled, count as legitimate.
+func fetchLabel(ctx context.Context, tx *sql.Tx, p models.PurchaseMessage) (bool, error) {
+	const stmt = `SELECT
+			EXISTS (SELECT 1 FROM purchase_label WHERE purchase_id = $1)
+			OR EXISTS (SELECT 1 FROM anomaly WHERE purchase_id = $1 AND customer_id = $2 AND label = $3)`
+
+	var fraud bool
+	err := tx.QueryRowContext(ctx, stmt, p.ID, p.CustomerID, string(feedback.LabelConfirmedFraud)).Scan(&fraud)
+	return fraud, err
+}
@@ -0,0 +1,105 @@
+package backtest
+
+import (
+	"bufio"
+	"context"
+	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"crdb/ai_ml/fraud_detection/app/pkg/vectorize"
+	"database/sql"
+	"fmt"
+	"io"
+	"time"
+)
+
+// maxLineSize is the longest dump line that can be read.
+const maxLineSize = 1 << 20
+
+// Purchases reads the purchases made in [from, to) from the database, oldest
+// first.
+func Purchases(ctx context.Context, db *sql.DB, from, to time.Time) ([]models.PurchaseMessage, error) {
+	const stmt = `SELECT id, customer_id, amount, ts, vec::STRING
+		FROM purchase
+		WHERE ts >= $1 AND ts < $2
+		AND vec IS NOT NULL
+		ORDER BY ts`
+
+	rows, err := db.QueryContext(ctx, stmt, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("making query: %w", err)
+	}
+	defer rows.Close()
+
+	var purchases []models.PurchaseMessage
+	for rows.Next() {
+		var p models.PurchaseMessage
+		var vec string
+
+		if err = rows.Scan(&p.ID, &p.CustomerID, &p.Amount, &p.Timestamp, &vec); err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+
+		if p.Vector, err = models.ParseVector(vec); err != nil {
+			return nil, fmt.Errorf("parsing vector of purchase %s: %w", p.ID, err)
+		}
+
+		purchases = append(purchases, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating rows: %w", err)
+	}
+
+	return purchases, nil
+}
+
+// ReadDump reads purchases from a dump of the purchase topic, holding one
+// changefeed message value per line, such as `kcat -C -t purchase -e -q`
+// writes. Deletes and resolved timestamps are skipped, and a purchase that
+// appears more than once is replayed once, as it was last.
+func ReadDump(r io.Reader, envelope models.Envelope) ([]models.PurchaseMessage, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	var purchases []models.PurchaseMessage
+	seen := map[string]int{}
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		m, err := models.DecodeChangefeed(envelope, "purchase", nil, scanner.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("decoding line %d: %w", line, err)
+		}
+
+		if len(m.Payload) == 0 {
+			continue
+		}
+
+		var p models.PurchaseMessage
+		if err = models.ParsePayload(m, &p); err != nil {
+			return nil, fmt.Errorf("parsing line %d: %w", line, err)
+		}
+
+		// Vectors can be left out of the changefeed, as they can be
+		// computed from the purchase.
+		if len(p.Vector) == 0 {
+			if vp, ok := vectorize.FromMessage(p); ok {
+				p.Vector = vectorize.Vector(vp)
+			}
+		}
+
+		if i, ok := seen[p.ID]; ok {
+			purchases[i] = p
+			continue
+		}
+
+		seen[p.ID] = len(purchases)
+		purchases = append(purchases, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading dump: %w", err)
+	}
+
+	return purchases, nil
+}
@@ -0,0 +1,73 @@
+package bus
+
+import (
+	"context"
+	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// handleTimeout bounds how long a handler has to process a message it has
+// been given, including during shutdown.
+const handleTimeout = time.Second * 30
+
+// lagInterval is how often consumers report how far behind they are.
+const lagInterval = time.Second * 5
+
+// Handler processes a single message. A message is committed once its handler
+// returns without error, or once the consumer's RetryPolicy gives up on it.
+type Handler func(context.Context, models.Message) error
+
+// Bus creates consumers for topics and publishes messages to them. Drain
+// waits for running consumers to stop once their context has been cancelled.
+type Bus interface {
+	NewConsumer(topic string, opts ...ConsumerOption) Consumer
+	Publish(ctx context.Context, msg models.Message) error
+	Drain(ctx context.Context) error
+	Close() error
+}
+
+// Consumer delivers the messages of a topic to a handler, as part of the
+// consumer group of the Bus that created it. Run returns once the context is
+// cancelled and any in-flight message has been handled and committed.
+//
+// Resolved timestamps aren't passed to the handler. Instead, Watermark returns
+// the resolved timestamp up to which every partition has been processed.
+//
+// Ready returns an error until the consumer has been assigned partitions to
+// read from, and while it repeatedly fails to fetch messages.
+type Consumer interface {
+	Run(ctx context.Context, f Handler)
+	Watermark() models.HLC
+	Ready() error
+}
+
+// errNotAssigned is returned by Ready for consumers without partitions.
+var errNotAssigned = errors.New("consumer has not been assigned partitions")
+
+// running tracks the consumers a bus has started, so that Drain can wait for
+// them to finish their in-flight messages.
+type running struct {
+	wg sync.WaitGroup
+}
+
+func (r *running) start() { r.wg.Add(1) }
+
+func (r *running) stop() { r.wg.Done() }
+
+func (r *running) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for consumers: %w", ctx.Err())
+	}
+}
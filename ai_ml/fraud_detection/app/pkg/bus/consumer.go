@@ -0,0 +1,75 @@
+package bus
+
+import "crdb/ai_ml/fraud_detection/app/pkg/models"
+
+type ConsumerOption func(*consumerConfig)
+
+// WithName identifies the agent a consumer is running for.
+func WithName(name string) ConsumerOption {
+	return func(c *consumerConfig) {
+		c.name = name
+	}
+}
+
+// WithGroup sets the consumer group a consumer joins, in place of the one
+// its bus was created with.
+func WithGroup(id string) ConsumerOption {
+	return func(c *consumerConfig) {
+		c.groupID = id
+	}
+}
+
+func WithRetry(p RetryPolicy) ConsumerOption {
+	return func(c *consumerConfig) {
+		c.retry = p
+	}
+}
+
+// WithWorkers sets how many messages a consumer processes concurrently.
+func WithWorkers(n int) ConsumerOption {
+	return func(c *consumerConfig) {
+		c.workers = n
+	}
+}
+
+// WithOrderingKey determines which messages must be processed in the order
+// they were fetched. Messages for which f returns an empty string fall back
+// to their message key.
+func WithOrderingKey(f func(models.Message) string) ConsumerOption {
+	return func(c *consumerConfig) {
+		c.orderingKey = f
+	}
+}
+
+// WithEnvelope sets the changefeed envelope that consumed messages are
+// decoded with.
+func WithEnvelope(e models.Envelope) ConsumerOption {
+	return func(c *consumerConfig) {
+		c.envelope = e
+	}
+}
+
+type consumerConfig struct {
+	name        string
+	groupID     string
+	retry       RetryPolicy
+	workers     int
+	orderingKey func(models.Message) string
+	envelope    models.Envelope
+}
+
+func newConsumerConfig(opts []ConsumerOption) consumerConfig {
+	c := consumerConfig{
+		retry:       RetryPolicy{MaxAttempts: 1},
+		envelope:    models.EnvelopeRow,
+		orderingKey: func(models.Message) string { return "" },
+	}
+
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	c.retry.MaxAttempts = max(c.retry.MaxAttempts, 1)
+	c.workers = max(c.workers, 1)
+	return c
+}
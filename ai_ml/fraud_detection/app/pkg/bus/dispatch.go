@@ -0,0 +1,185 @@
+package bus
+
+import (
+	"context"
+	"crdb/ai_ml/fraud_detection/app/pkg/metrics"
+	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"hash/fnv"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// inflight is a fetched message that is waiting to be processed or committed.
+// A message that couldn't be decoded carries the error, and is dead-lettered
+// without being handled.
+type inflight struct {
+	partition int
+	offset    int64
+	msg       models.Message
+	err       error
+	commit    func(context.Context) error
+	done      bool
+}
+
+// dispatcher processes messages on a pool of workers. Messages with the same
+// ordering key always go to the same worker, so they're processed in the order
+// they were fetched. A partition's offset is only committed once every message
+// fetched before it has been processed.
+type dispatcher struct {
+	cfg        consumerConfig
+	pub        Bus
+	f          Handler
+	watermarks *watermarks
+
+	queues []chan *inflight
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	pending map[int][]*inflight
+
+	commitMu  sync.Mutex
+	committed map[int]int64
+}
+
+func newDispatcher(ctx context.Context, cfg consumerConfig, pub Bus, w *watermarks, f Handler) *dispatcher {
+	d := &dispatcher{
+		cfg:        cfg,
+		pub:        pub,
+		f:          f,
+		watermarks: w,
+		queues:     make([]chan *inflight, cfg.workers),
+		pending:    map[int][]*inflight{},
+		committed:  map[int]int64{},
+	}
+
+	for i := range d.queues {
+		d.queues[i] = make(chan *inflight, 1)
+
+		d.wg.Add(1)
+		go d.work(ctx, d.queues[i])
+	}
+
+	return d
+}
+
+// dispatch hands a message to its worker, blocking while that worker is busy.
+// Resolved timestamps aren't handled by a worker, but still wait for earlier
+// messages in their partition before advancing its watermark.
+func (d *dispatcher) dispatch(ctx context.Context, m *inflight) {
+	d.mu.Lock()
+	d.pending[m.partition] = append(d.pending[m.partition], m)
+	d.mu.Unlock()
+
+	if m.msg.Operation != models.OperationResolved {
+		metrics.MessagesConsumed.WithLabelValues(d.cfg.name).Inc()
+	}
+
+	if m.err == nil && m.msg.Operation == models.OperationResolved {
+		if err := d.complete(ctx, m); err != nil {
+			log.Printf("[%s] error committing resolved timestamp: %v", d.cfg.name, err)
+		}
+		return
+	}
+
+	d.queues[d.worker(m.msg)] <- m
+}
+
+func (d *dispatcher) worker(m models.Message) int {
+	key := d.cfg.orderingKey(m)
+	if key == "" {
+		key = strings.Join(m.Key, ",")
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	return int(h.Sum32() % uint32(len(d.queues)))
+}
+
+// stop waits for the workers to finish the messages they've been given.
+func (d *dispatcher) stop() {
+	for _, q := range d.queues {
+		close(q)
+	}
+
+	d.wg.Wait()
+}
+
+func (d *dispatcher) work(ctx context.Context, q <-chan *inflight) {
+	defer d.wg.Done()
+
+	for m := range q {
+		start := time.Now()
+
+		var err error
+		if m.err != nil {
+			err = d.cfg.deadLetter(ctx, d.pub, m.msg, StageDecode, 0, m.err)
+		} else {
+			err = d.cfg.process(ctx, d.pub, m.msg, d.f)
+		}
+
+		metrics.ProcessingLatency.WithLabelValues(d.cfg.name).Observe(time.Since(start).Seconds())
+
+		// Messages only fail here once shutdown has begun, or when they've
+		// been given up on without a dead-letter topic. They stay pending,
+		// holding back commits for their partition so they're redelivered
+		// after a restart.
+		if err != nil {
+			log.Printf("[%s] error handling message: %v", d.cfg.name, err)
+			continue
+		}
+
+		if !m.msg.Updated.IsZero() {
+			lag := time.Since(m.msg.Updated.Time())
+			metrics.EndToEndLag.WithLabelValues(d.cfg.name).Observe(lag.Seconds())
+		}
+
+		if err := d.complete(ctx, m); err != nil {
+			log.Printf("[%s] error committing message: %v", d.cfg.name, err)
+		}
+	}
+}
+
+// complete marks a message as processed and commits the furthest offset in
+// its partition for which every earlier message has also been processed.
+func (d *dispatcher) complete(ctx context.Context, m *inflight) error {
+	d.mu.Lock()
+	m.done = true
+
+	var last *inflight
+	queue := d.pending[m.partition]
+	for len(queue) > 0 && queue[0].done {
+		last, queue = queue[0], queue[1:]
+
+		if last.msg.Operation == models.OperationResolved {
+			d.watermarks.resolve(last.partition, last.msg.Resolved)
+		}
+	}
+	d.pending[m.partition] = queue
+	d.mu.Unlock()
+
+	if last == nil {
+		return nil
+	}
+
+	// Commits from different workers can race, so never let a lower offset
+	// overwrite a higher one.
+	d.commitMu.Lock()
+	defer d.commitMu.Unlock()
+
+	if c, ok := d.committed[last.partition]; ok && c >= last.offset {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), handleTimeout)
+	defer cancel()
+
+	if err := last.commit(ctx); err != nil {
+		return err
+	}
+
+	d.committed[last.partition] = last.offset
+	return nil
+}
@@ -0,0 +1,142 @@
+package bus
+
+import (
+	"context"
+	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type commits struct {
+	mu      sync.Mutex
+	offsets []int64
+}
+
+func (c *commits) add(offset int64) func(context.Context) error {
+	return func(context.Context) error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		c.offsets = append(c.offsets, offset)
+		return nil
+	}
+}
+
+func (c *commits) get() []int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]int64{}, c.offsets...)
+}
+
+func TestDispatcherCommitsContiguousOffsets(t *testing.T) {
+	release := make(chan struct{})
+	handled := make(chan string, 2)
+
+	f := func(ctx context.Context, m models.Message) error {
+		if m.Key[0] == "slow" {
+			<-release
+		}
+		handled <- m.Key[0]
+		return nil
+	}
+
+	cfg := newConsumerConfig([]ConsumerOption{WithWorkers(16)})
+	d := newDispatcher(context.Background(), cfg, nil, newWatermarks("agent.test", "purchase"), f)
+
+	var c commits
+	d.dispatch(context.Background(), &inflight{offset: 0, msg: models.Message{Key: []string{"slow"}}, commit: c.add(0)})
+	d.dispatch(context.Background(), &inflight{offset: 1, msg: models.Message{Key: []string{"fast"}}, commit: c.add(1)})
+
+	// The later message finishes first, but can't be committed yet.
+	assert.Equal(t, "fast", <-handled)
+	assert.Empty(t, c.get())
+
+	close(release)
+	assert.Equal(t, "slow", <-handled)
+	d.stop()
+
+	assert.Equal(t, []int64{1}, c.get())
+}
+
+func TestDispatcherPreservesOrderPerKey(t *testing.T) {
+	var mu sync.Mutex
+	got := map[string][]int{}
+
+	f := func(ctx context.Context, m models.Message) error {
+		var seq int
+		fmt.Sscanf(string(m.Payload), "%d", &seq)
+
+		// Give later messages a chance to overtake earlier ones.
+		time.Sleep(time.Duration(10-seq) * time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		got[m.Key[0]] = append(got[m.Key[0]], seq)
+		return nil
+	}
+
+	byCustomer := func(m models.Message) string { return m.Headers["customer_id"] }
+
+	cfg := newConsumerConfig([]ConsumerOption{WithWorkers(4), WithOrderingKey(byCustomer)})
+	d := newDispatcher(context.Background(), cfg, nil, newWatermarks("agent.test", "purchase"), f)
+
+	var c commits
+	var offset int64
+	for seq := range 10 {
+		for _, customer := range []string{"a", "b", "c"} {
+			d.dispatch(context.Background(), &inflight{
+				offset: offset,
+				msg: models.Message{
+					Key:     []string{customer},
+					Payload: []byte(fmt.Sprint(seq)),
+					Headers: map[string]string{"customer_id": customer},
+				},
+				commit: c.add(offset),
+			})
+			offset++
+		}
+	}
+	d.stop()
+
+	for _, customer := range []string{"a", "b", "c"} {
+		assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, got[customer])
+	}
+
+	commits := c.get()
+	assert.IsIncreasing(t, commits)
+	assert.Equal(t, offset-1, commits[len(commits)-1])
+}
+
+func TestDispatcherWatermarks(t *testing.T) {
+	release := make(chan struct{})
+	f := func(ctx context.Context, m models.Message) error {
+		<-release
+		return nil
+	}
+
+	w := newWatermarks("agent.test", "purchase")
+	d := newDispatcher(context.Background(), newConsumerConfig(nil), nil, w, f)
+
+	ts1 := models.HLC{WallTime: 100}
+	ts2 := models.HLC{WallTime: 200}
+
+	var c commits
+	d.dispatch(context.Background(), &inflight{partition: 0, offset: 0, msg: models.Message{Key: []string{"a"}}, commit: c.add(0)})
+	d.dispatch(context.Background(), &inflight{partition: 0, offset: 1, msg: models.Message{Operation: models.OperationResolved, Resolved: ts2}, commit: c.add(1)})
+	d.dispatch(context.Background(), &inflight{partition: 1, offset: 0, msg: models.Message{Operation: models.OperationResolved, Resolved: ts1}, commit: c.add(0)})
+
+	// Partition 0's resolved timestamp waits for the message before it.
+	assert.Equal(t, ts1, w.global())
+	assert.Equal(t, map[int]models.HLC{1: ts1}, w.partitions)
+
+	close(release)
+	d.stop()
+
+	assert.Equal(t, map[int]models.HLC{0: ts2, 1: ts1}, w.partitions)
+	assert.Equal(t, ts1, w.global())
+}
@@ -1,80 +1,270 @@
 package bus
 
 import (
+	"cmp"
 	"context"
+	"crdb/ai_ml/fraud_detection/app/pkg/metrics"
 	"crdb/ai_ml/fraud_detection/app/pkg/models"
-	"errors"
+	"encoding/json"
 	"fmt"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/segmentio/kafka-go"
 )
 
+// fetchRetry is how Run backs off after failing to fetch a message, such as
+// while the brokers are unreachable.
+var fetchRetry = RetryPolicy{
+	InitialBackoff: time.Millisecond * 100,
+	MaxBackoff:     time.Second * 10,
+}
+
+// fetchWindow is how recently a consumer must have fetched from a partition to
+// count as assigned one. Readers long-poll their partitions for at most
+// MaxWait, 10s by default, so an assigned reader fetches more often than this.
+const fetchWindow = time.Second * 30
+
+// maxFetchFailures is how many fetches in a row can fail before a consumer
+// reports that it isn't ready.
+const maxFetchFailures = 3
+
 type KafkaBus struct {
 	brokers []string
 	groupID string
+	writer  *kafka.Writer
+	running running
 }
 
 func NewKafkaBus(brokers []string, groupID string) *KafkaBus {
 	return &KafkaBus{
 		brokers: brokers,
 		groupID: groupID,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+
+			AllowAutoTopicCreation: true,
+		},
+	}
+}
+
+func (b *KafkaBus) NewConsumer(topic string, opts ...ConsumerOption) Consumer {
+	cfg := newConsumerConfig(opts)
+
+	c := &KafkaConsumer{
+		bus:        b,
+		cfg:        cfg,
+		running:    &b.running,
+		watermarks: newWatermarks(cfg.name, topic),
 	}
+
+	c.reader = kafka.NewReader(kafka.ReaderConfig{
+		Brokers: b.brokers,
+		GroupID: cmp.Or(cfg.groupID, b.groupID),
+		Topic:   topic,
+	})
+
+	return c
 }
 
-func (b *KafkaBus) NewConsumer(topic string) *Consumer {
-	return &Consumer{
-		reader: kafka.NewReader(kafka.ReaderConfig{
-			Brokers: b.brokers,
-			GroupID: b.groupID,
-			Topic:   topic,
-		}),
+// Publish writes a message to its topic. Keys are encoded as JSON arrays, in
+// the same way as changefeed keys.
+func (b *KafkaBus) Publish(ctx context.Context, msg models.Message) error {
+	key, err := json.Marshal(msg.Key)
+	if err != nil {
+		return fmt.Errorf("marshalling key: %w", err)
+	}
+
+	m := kafka.Message{
+		Topic: msg.Topic,
+		Key:   key,
+		Value: msg.Payload,
+	}
+
+	for k, v := range msg.Headers {
+		m.Headers = append(m.Headers, kafka.Header{Key: k, Value: []byte(v)})
 	}
+
+	if err = b.writer.WriteMessages(ctx, m); err != nil {
+		return fmt.Errorf("writing message: %w", err)
+	}
+
+	return nil
 }
 
-func (b *KafkaBus) Close() error { return nil }
+// Close flushes any pending published messages. Call it after Drain.
+func (b *KafkaBus) Close() error {
+	return b.writer.Close()
+}
+
+// Drain waits for every running consumer to return, or for the context to be
+// done, whichever happens first.
+func (b *KafkaBus) Drain(ctx context.Context) error {
+	return b.running.wait(ctx)
+}
 
-func (b *KafkaBus) Drain(ctx context.Context) error { return nil }
+type KafkaConsumer struct {
+	bus        *KafkaBus
+	cfg        consumerConfig
+	reader     *kafka.Reader
+	running    *running
+	watermarks *watermarks
+	assignment assignment
+	fetches    fetchHealth
+}
 
-type Consumer struct{ reader *kafka.Reader }
+// Run blocks until the context is cancelled.
+func (c *KafkaConsumer) Run(ctx context.Context, f Handler) {
+	c.running.start()
+	defer c.running.stop()
 
-func (c *Consumer) Run(ctx context.Context, f func(context.Context, models.Message) error) {
 	defer c.reader.Close()
 
+	d := newDispatcher(ctx, c.cfg, c.bus, c.watermarks, f)
+	defer d.stop()
+
+	go c.reportStats(ctx)
+
 	for {
-		if err := c.handleMessage(f); err != nil {
-			if errors.Is(err, context.DeadlineExceeded) {
-				continue
+		m, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			failures := c.fetches.fail(err)
+			log.Printf("[%s] error fetching message (%d in a row): %v", c.cfg.name, failures, err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(fetchRetry.backoff(failures)):
 			}
+			continue
+		}
+		c.fetches.succeed()
+		c.assignment.fetched(time.Now())
 
-			log.Printf("error handling message: %v", err)
+		mm, err := models.DecodeChangefeed(c.cfg.envelope, m.Topic, m.Key, m.Value)
+		if err != nil {
+			mm = models.Message{Key: []string{string(m.Key)}, Topic: m.Topic, Raw: m.Value}
+			err = fmt.Errorf("decoding message: %w", err)
 		}
+		setHeaders(&mm, m.Headers)
+
+		d.dispatch(ctx, &inflight{
+			partition: m.Partition,
+			offset:    m.Offset,
+			msg:       mm,
+			err:       err,
+			commit: func(ctx context.Context) error {
+				return c.reader.CommitMessages(ctx, m)
+			},
+		})
 	}
 }
 
-func (c *Consumer) handleMessage(f func(context.Context, models.Message) error) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
-	defer cancel()
+// reportStats reports lag and tracks assignment from the reader's stats, which
+// are reset each time they're read.
+func (c *KafkaConsumer) reportStats(ctx context.Context) {
+	ticker := time.NewTicker(lagInterval)
+	defer ticker.Stop()
 
-	m, err := c.reader.FetchMessage(ctx)
-	if err != nil {
-		return fmt.Errorf("fetching message: %w", err)
-	}
+	lag := metrics.ConsumerLag.WithLabelValues(c.cfg.name, c.reader.Config().Topic)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			stats := c.reader.Stats()
+			lag.Set(float64(stats.Lag))
 
-	mm := models.Message{
-		Key:     []string{string(m.Key)},
-		Topic:   m.Topic,
-		Payload: m.Value,
+			if stats.Fetches > 0 {
+				c.assignment.fetched(now)
+			}
+		}
 	}
+}
+
+func (c *KafkaConsumer) Watermark() models.HLC {
+	return c.watermarks.global()
+}
 
-	if err := f(ctx, mm); err != nil {
-		return fmt.Errorf("handing message: %w", err)
+func (c *KafkaConsumer) Ready() error {
+	if err := c.fetches.err(); err != nil {
+		return err
 	}
 
-	if err := c.reader.CommitMessages(ctx, m); err != nil {
-		return fmt.Errorf("committing message: %w", err)
+	if !c.assignment.assigned(time.Now()) {
+		return errNotAssigned
 	}
 
 	return nil
 }
+
+// fetchHealth tracks how many fetches in a row have failed, and why the last
+// one did.
+type fetchHealth struct {
+	mu       sync.Mutex
+	failures int
+	last     error
+}
+
+func (h *fetchHealth) fail(err error) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.failures++
+	h.last = err
+	return h.failures
+}
+
+func (h *fetchHealth) succeed() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.failures = 0
+	h.last = nil
+}
+
+func (h *fetchHealth) err() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.failures < maxFetchFailures {
+		return nil
+	}
+
+	return fmt.Errorf("%d fetches in a row failed: %w", h.failures, h.last)
+}
+
+// assignment tracks whether a reader has been assigned partitions. kafka-go
+// doesn't expose consumer group assignments, but a reader only fetches from
+// the partitions it has been assigned, so it counts as assigned for as long as
+// it keeps fetching.
+type assignment struct {
+	lastFetch atomic.Int64
+}
+
+func (a *assignment) fetched(at time.Time) {
+	a.lastFetch.Store(at.UnixNano())
+}
+
+func (a *assignment) assigned(now time.Time) bool {
+	last := a.lastFetch.Load()
+	return last != 0 && now.Sub(time.Unix(0, last)) < fetchWindow
+}
+
+func setHeaders(mm *models.Message, headers []kafka.Header) {
+	for _, h := range headers {
+		if mm.Headers == nil {
+			mm.Headers = map[string]string{}
+		}
+		mm.Headers[h.Key] = string(h.Value)
+	}
+}
@@ -0,0 +1,37 @@
+package bus
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssignment(t *testing.T) {
+	now := time.Now()
+
+	var a assignment
+	assert.False(t, a.assigned(now))
+
+	a.fetched(now)
+	assert.True(t, a.assigned(now.Add(fetchWindow-time.Second)))
+
+	// A rebalance can leave a member without partitions to fetch from.
+	assert.False(t, a.assigned(now.Add(fetchWindow)))
+}
+
+func TestFetchHealth(t *testing.T) {
+	var h fetchHealth
+
+	for range maxFetchFailures - 1 {
+		h.fail(errors.New("broker unreachable"))
+	}
+	assert.NoError(t, h.err())
+
+	assert.Equal(t, maxFetchFailures, h.fail(errors.New("broker unreachable")))
+	assert.ErrorContains(t, h.err(), "broker unreachable")
+
+	h.succeed()
+	assert.NoError(t, h.err())
+}
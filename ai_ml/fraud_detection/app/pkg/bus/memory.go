@@ -0,0 +1,263 @@
+package bus
+
+import (
+	"cmp"
+	"context"
+	"crdb/ai_ml/fraud_detection/app/pkg/metrics"
+	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MemoryBroker is an in-process stand-in for a Kafka cluster. Each topic is
+// an append-only log that every consumer group reads independently.
+type MemoryBroker struct {
+	mu     sync.Mutex
+	topics map[string]*memoryTopic
+}
+
+type memoryTopic struct {
+	messages []models.Message
+	groups   map[string]*memoryGroup
+
+	// appended is closed and replaced every time a message is published.
+	appended chan struct{}
+}
+
+type memoryGroup struct {
+	next      int
+	committed int
+	consumers int
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		topics: map[string]*memoryTopic{},
+	}
+}
+
+func (b *MemoryBroker) topic(name string) *memoryTopic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &memoryTopic{
+			groups:   map[string]*memoryGroup{},
+			appended: make(chan struct{}),
+		}
+		b.topics[name] = t
+	}
+
+	return t
+}
+
+func (t *memoryTopic) group(id string) *memoryGroup {
+	g, ok := t.groups[id]
+	if !ok {
+		g = &memoryGroup{}
+		t.groups[id] = g
+	}
+
+	return g
+}
+
+func (b *MemoryBroker) publish(msg models.Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topic(msg.Topic)
+	t.messages = append(t.messages, msg)
+
+	close(t.appended)
+	t.appended = make(chan struct{})
+}
+
+// fetch blocks until the group has a message it hasn't yet handed out, or the
+// context is cancelled.
+func (b *MemoryBroker) fetch(ctx context.Context, topic, groupID string) (int, models.Message, error) {
+	for {
+		b.mu.Lock()
+		t := b.topic(topic)
+		g := t.group(groupID)
+
+		if g.next < len(t.messages) {
+			offset := g.next
+			m := t.messages[offset]
+			g.next++
+			b.mu.Unlock()
+
+			return offset, m, nil
+		}
+
+		appended := t.appended
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return 0, models.Message{}, ctx.Err()
+		case <-appended:
+		}
+	}
+}
+
+func (b *MemoryBroker) commit(topic, groupID string, offset int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g := b.topic(topic).group(groupID)
+	g.committed = max(g.committed, offset+1)
+}
+
+func (b *MemoryBroker) join(topic, groupID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.topic(topic).group(groupID).consumers++
+}
+
+// leave removes a consumer from a group. Once the last consumer leaves, the
+// group rewinds to its committed offset, so uncommitted messages are handed
+// out again, much like a Kafka rebalance.
+func (b *MemoryBroker) leave(topic, groupID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g := b.topic(topic).group(groupID)
+	g.consumers--
+
+	if g.consumers == 0 {
+		g.next = g.committed
+	}
+}
+
+// MemoryBus is a Bus backed by a MemoryBroker. Like KafkaBus, every consumer
+// it creates belongs to the same consumer group.
+type MemoryBus struct {
+	broker  *MemoryBroker
+	groupID string
+	running running
+}
+
+func NewMemoryBus(broker *MemoryBroker, groupID string) *MemoryBus {
+	return &MemoryBus{
+		broker:  broker,
+		groupID: groupID,
+	}
+}
+
+func (b *MemoryBus) NewConsumer(topic string, opts ...ConsumerOption) Consumer {
+	cfg := newConsumerConfig(opts)
+
+	return &MemoryConsumer{
+		bus:        b,
+		cfg:        cfg,
+		watermarks: newWatermarks(cfg.name, topic),
+		broker:     b.broker,
+		groupID:    cmp.Or(cfg.groupID, b.groupID),
+		topic:      topic,
+		running:    &b.running,
+	}
+}
+
+func (b *MemoryBus) Publish(ctx context.Context, msg models.Message) error {
+	if msg.Topic == "" {
+		return fmt.Errorf("missing topic")
+	}
+
+	b.broker.publish(msg)
+	return nil
+}
+
+// Committed returns the offset of the first message in a topic that the
+// bus's consumer group has not committed.
+func (b *MemoryBus) Committed(topic string) int {
+	b.broker.mu.Lock()
+	defer b.broker.mu.Unlock()
+
+	return b.broker.topic(topic).group(b.groupID).committed
+}
+
+func (b *MemoryBus) Close() error { return nil }
+
+func (b *MemoryBus) Drain(ctx context.Context) error {
+	return b.running.wait(ctx)
+}
+
+type MemoryConsumer struct {
+	bus        *MemoryBus
+	cfg        consumerConfig
+	watermarks *watermarks
+	broker     *MemoryBroker
+	groupID    string
+	topic      string
+	running    *running
+	joined     atomic.Bool
+}
+
+// Run blocks until the context is cancelled.
+func (c *MemoryConsumer) Run(ctx context.Context, f Handler) {
+	c.running.start()
+	defer c.running.stop()
+
+	c.broker.join(c.topic, c.groupID)
+	defer c.broker.leave(c.topic, c.groupID)
+
+	c.joined.Store(true)
+	defer c.joined.Store(false)
+
+	d := newDispatcher(ctx, c.cfg, c.bus, c.watermarks, f)
+	defer d.stop()
+
+	go c.reportLag(ctx)
+
+	for {
+		offset, m, err := c.broker.fetch(ctx, c.topic, c.groupID)
+		if err != nil {
+			return
+		}
+
+		d.dispatch(ctx, &inflight{
+			offset: int64(offset),
+			msg:    m,
+			commit: func(context.Context) error {
+				c.broker.commit(c.topic, c.groupID, offset)
+				return nil
+			},
+		})
+	}
+}
+
+func (c *MemoryConsumer) reportLag(ctx context.Context) {
+	ticker := time.NewTicker(lagInterval)
+	defer ticker.Stop()
+
+	lag := metrics.ConsumerLag.WithLabelValues(c.cfg.name, c.topic)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.broker.mu.Lock()
+			t := c.broker.topic(c.topic)
+			n := len(t.messages) - t.group(c.groupID).committed
+			c.broker.mu.Unlock()
+
+			lag.Set(float64(n))
+		}
+	}
+}
+
+func (c *MemoryConsumer) Watermark() models.HLC {
+	return c.watermarks.global()
+}
+
+// Ready returns nil while the consumer is running, as members of a group share
+// the whole topic rather than being assigned partitions of it.
+func (c *MemoryConsumer) Ready() error {
+	if !c.joined.Load() {
+		return errNotAssigned
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package bus
+
+import (
+	"context"
+	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func publish(t *testing.T, b Bus, topic string, payloads ...string) {
+	for _, p := range payloads {
+		msg := models.Message{Topic: topic, Payload: []byte(p)}
+		assert.NoError(t, b.Publish(context.Background(), msg))
+	}
+}
+
+// collect runs a consumer until it has handled n messages.
+func collect(t *testing.T, c Consumer, n int, f Handler) []string {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	var mu sync.Mutex
+	var got []string
+
+	c.Run(ctx, func(ctx context.Context, m models.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err := f(ctx, m); err != nil {
+			return err
+		}
+
+		if got = append(got, string(m.Payload)); len(got) == n {
+			cancel()
+		}
+		return nil
+	})
+
+	assert.Len(t, got, n)
+	return got
+}
+
+func accept(context.Context, models.Message) error { return nil }
+
+func TestMemoryBusTopics(t *testing.T) {
+	broker := NewMemoryBroker()
+	b := NewMemoryBus(broker, "group")
+
+	publish(t, b, "purchase", "p1", "p2")
+	publish(t, b, "anomaly", "a1")
+
+	assert.Equal(t, []string{"p1", "p2"}, collect(t, b.NewConsumer("purchase"), 2, accept))
+	assert.Equal(t, []string{"a1"}, collect(t, b.NewConsumer("anomaly"), 1, accept))
+}
+
+func TestMemoryBusConsumerGroups(t *testing.T) {
+	broker := NewMemoryBroker()
+	a := NewMemoryBus(broker, "a")
+	b := NewMemoryBus(broker, "b")
+
+	publish(t, a, "purchase", "p1", "p2", "p3")
+
+	// Every group sees every message.
+	assert.Equal(t, []string{"p1", "p2", "p3"}, collect(t, a.NewConsumer("purchase"), 3, accept))
+	assert.Equal(t, []string{"p1", "p2", "p3"}, collect(t, b.NewConsumer("purchase"), 3, accept))
+
+	// A group that has committed everything sees only new messages.
+	publish(t, a, "purchase", "p4")
+	assert.Equal(t, []string{"p4"}, collect(t, a.NewConsumer("purchase"), 1, accept))
+
+	// Consumers can join a group other than their bus's.
+	all := []string{"p1", "p2", "p3", "p4"}
+	assert.Equal(t, all, collect(t, a.NewConsumer("purchase", WithGroup("c")), 4, accept))
+}
+
+func TestMemoryBusSharesMessagesWithinGroup(t *testing.T) {
+	broker := NewMemoryBroker()
+	b := NewMemoryBus(broker, "group")
+
+	publish(t, b, "purchase", "p1", "p2", "p3", "p4")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	var mu sync.Mutex
+	seen := map[string]int{}
+
+	handler := func(ctx context.Context, m models.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		seen[string(m.Payload)]++
+		if len(seen) == 4 {
+			cancel()
+		}
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.NewConsumer("purchase").Run(ctx, handler)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, map[string]int{"p1": 1, "p2": 1, "p3": 1, "p4": 1}, seen)
+	assert.Equal(t, 4, b.Committed("purchase"))
+}
+
+func TestMemoryBusRedeliversUncommitted(t *testing.T) {
+	broker := NewMemoryBroker()
+	b := NewMemoryBus(broker, "group")
+
+	publish(t, b, "purchase", "p1")
+
+	fail := func(context.Context, models.Message) error { return errors.New("boom") }
+	policy := RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Minute, MaxBackoff: time.Minute}
+
+	// Shutting down while waiting to retry leaves the message uncommitted.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	b.NewConsumer("purchase", WithRetry(policy)).Run(ctx, fail)
+
+	assert.Equal(t, 0, b.Committed("purchase"))
+
+	// Once the failing consumer has left the group, the message is redelivered.
+	assert.Equal(t, []string{"p1"}, collect(t, b.NewConsumer("purchase"), 1, accept))
+	assert.Equal(t, 1, b.Committed("purchase"))
+}
+
+func TestMemoryBusDrainWaitsForInFlight(t *testing.T) {
+	broker := NewMemoryBroker()
+	b := NewMemoryBus(broker, "group")
+
+	publish(t, b, "purchase", "p1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+
+	slow := func(ctx context.Context, m models.Message) error {
+		close(started)
+		time.Sleep(time.Millisecond * 100)
+		return ctx.Err()
+	}
+
+	go b.NewConsumer("purchase").Run(ctx, slow)
+
+	<-started
+	cancel()
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancelDrain()
+
+	assert.NoError(t, b.Drain(drainCtx))
+	assert.Equal(t, 1, b.Committed("purchase"))
+}
@@ -0,0 +1,220 @@
+package bus
+
+import (
+	"context"
+	"crdb/ai_ml/fraud_detection/app/pkg/metrics"
+	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Headers added to messages published to a dead-letter topic. The key and
+// value are those of the original message.
+const (
+	HeaderDeadLetterAgent    = "dead-letter-agent"
+	HeaderDeadLetterTopic    = "dead-letter-topic"
+	HeaderDeadLetterStage    = "dead-letter-stage"
+	HeaderDeadLetterAttempts = "dead-letter-attempts"
+	HeaderDeadLetterError    = "dead-letter-error"
+)
+
+// Stages at which a message can fail, as recorded in HeaderDeadLetterStage.
+// Messages that fail to decode are never handled, so have zero attempts.
+const (
+	StageDecode = "decode"
+	StageHandle = "handle"
+)
+
+// RetryPolicy determines how many times a failing message is retried, and
+// where it goes once those attempts are exhausted. Without a DeadLetterTopic,
+// exhausted messages are logged and left uncommitted, which holds back their
+// partition's commits until the consumer restarts and they're redelivered.
+//
+// Messages whose handler defers them are retried without using up attempts
+// until they've been deferred for MaxDeferral in total, after which further
+// deferrals count as failed attempts. A zero MaxDeferral leaves it uncapped.
+type RetryPolicy struct {
+	MaxAttempts     int
+	InitialBackoff  time.Duration
+	MaxBackoff      time.Duration
+	MaxDeferral     time.Duration
+	DeadLetterTopic string
+}
+
+// deadLetterRetry is how deadLetter backs off while the dead-letter topic
+// can't be written to.
+var deadLetterRetry = RetryPolicy{
+	InitialBackoff: time.Millisecond * 100,
+	MaxBackoff:     time.Second * 10,
+}
+
+// backoff returns how long to wait after a failed attempt, doubling from
+// InitialBackoff. A zero MaxBackoff leaves it uncapped.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt && d < math.MaxInt64/2; i++ {
+		d *= 2
+	}
+
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+
+	return d
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error as one that retrying won't fix, such as a payload
+// that can't be parsed, so the message goes straight to the dead-letter topic.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+type deferredError struct {
+	err   error
+	after time.Duration
+}
+
+func (e deferredError) Error() string { return e.err.Error() }
+
+func (e deferredError) Unwrap() error { return e.err }
+
+// minDeferral stops deferred messages from being retried in a tight loop.
+const minDeferral = time.Millisecond * 100
+
+// Defer marks an error as one caused by a dependency that's temporarily
+// unavailable, such as an LLM provider behind an open circuit breaker. The
+// message is retried after the given delay without using up an attempt, for
+// up to the retry policy's MaxDeferral, which holds up later messages with the
+// same ordering key but keeps it from being dead-lettered during an outage.
+func Defer(err error, after time.Duration) error {
+	return deferredError{err: err, after: after}
+}
+
+// process handles a message according to the consumer's retry policy. It only
+// returns an error if the message must not be committed, which happens if
+// shutdown interrupts the retries or the dead-letter publish, or if there's no
+// dead-letter topic.
+func (c consumerConfig) process(ctx context.Context, pub Bus, m models.Message, f Handler) error {
+	var err error
+	var attempt int
+	var deferredFor time.Duration
+
+	for attempt = 1; attempt <= c.retry.MaxAttempts; attempt++ {
+		if err = c.attempt(ctx, m, f); err == nil {
+			metrics.MessagesProcessed.WithLabelValues(c.name).Inc()
+			return nil
+		}
+		metrics.MessagesFailed.WithLabelValues(c.name).Inc()
+
+		var deferred deferredError
+		if errors.As(err, &deferred) && (c.retry.MaxDeferral <= 0 || deferredFor < c.retry.MaxDeferral) {
+			wait := max(deferred.after, minDeferral)
+			if c.retry.MaxDeferral > 0 {
+				wait = min(wait, c.retry.MaxDeferral-deferredFor)
+			}
+
+			log.Printf("[%s] deferring message for %s: %v", c.name, wait, err)
+
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("deferring message: %w", err)
+			case <-time.After(wait):
+			}
+
+			deferredFor += wait
+			attempt--
+			continue
+		}
+
+		if errors.As(err, &permanentError{}) || attempt == c.retry.MaxAttempts {
+			break
+		}
+
+		log.Printf("[%s] attempt %d failed: %v", c.name, attempt, err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("retrying message: %w", err)
+		case <-time.After(c.retry.backoff(attempt)):
+		}
+	}
+
+	return c.deadLetter(ctx, pub, m, StageHandle, attempt, err)
+}
+
+// attempt runs a handler once. A message that has been fetched is handled
+// even if shutdown begins in the meantime, so it's neither dropped nor
+// processed twice.
+func (c consumerConfig) attempt(ctx context.Context, m models.Message, f Handler) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), handleTimeout)
+	defer cancel()
+
+	return f(ctx, m)
+}
+
+func (c consumerConfig) deadLetter(ctx context.Context, pub Bus, m models.Message, stage string, attempts int, cause error) error {
+	// Committing the message without a dead-letter topic to send it to would
+	// lose it.
+	if c.retry.DeadLetterTopic == "" {
+		metrics.MessagesAbandoned.WithLabelValues(c.name).Inc()
+		return fmt.Errorf("giving up after %d attempt(s) without a dead-letter topic: %w", attempts, cause)
+	}
+
+	dl := models.Message{
+		Key:     m.Key,
+		Topic:   c.retry.DeadLetterTopic,
+		Payload: m.Payload,
+		Headers: maps.Clone(m.Headers),
+	}
+	if m.Raw != nil {
+		dl.Payload = m.Raw
+	}
+	if dl.Headers == nil {
+		dl.Headers = map[string]string{}
+	}
+
+	dl.Headers[HeaderDeadLetterAgent] = c.name
+	dl.Headers[HeaderDeadLetterTopic] = m.Topic
+	dl.Headers[HeaderDeadLetterStage] = stage
+	dl.Headers[HeaderDeadLetterAttempts] = strconv.Itoa(attempts)
+	dl.Headers[HeaderDeadLetterError] = cause.Error()
+
+	// Committing the message without writing it to the dead-letter topic
+	// would lose it, so keep trying until shutdown.
+	for attempt := 1; ; attempt++ {
+		err := c.publish(ctx, pub, dl)
+		if err == nil {
+			break
+		}
+
+		log.Printf("[%s] error publishing to dead-letter topic (attempt %d): %v", c.name, attempt, err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("publishing to dead-letter topic: %w (handler error: %v)", err, cause)
+		case <-time.After(deadLetterRetry.backoff(attempt)):
+		}
+	}
+
+	metrics.MessagesDeadLettered.WithLabelValues(c.name).Inc()
+	log.Printf("[%s] dead-lettered message after %d attempt(s): %v", c.name, attempts, cause)
+	return nil
+}
+
+func (c consumerConfig) publish(ctx context.Context, pub Bus, m models.Message) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), handleTimeout)
+	defer cancel()
+
+	return pub.Publish(ctx, m)
+}
@@ -0,0 +1,206 @@
+package bus
+
+import (
+	"context"
+	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Millisecond * 100, MaxBackoff: time.Second}
+
+	assert.Equal(t, time.Millisecond*100, p.backoff(1))
+	assert.Equal(t, time.Millisecond*200, p.backoff(2))
+	assert.Equal(t, time.Millisecond*800, p.backoff(4))
+	assert.Equal(t, time.Second, p.backoff(5))
+	assert.Equal(t, time.Second, p.backoff(100))
+
+	uncapped := RetryPolicy{InitialBackoff: time.Millisecond * 100}
+	assert.Equal(t, time.Millisecond*100, uncapped.backoff(1))
+	assert.Equal(t, time.Millisecond*1600, uncapped.backoff(5))
+	assert.Positive(t, uncapped.backoff(100))
+}
+
+func TestRetryDeadLetter(t *testing.T) {
+	cases := []struct {
+		name        string
+		err         error
+		expAttempts int
+	}{
+		{
+			name:        "transient error exhausts attempts",
+			err:         errors.New("database unavailable"),
+			expAttempts: 3,
+		},
+		{
+			name:        "permanent error skips retries",
+			err:         Permanent(errors.New("parsing purchase message")),
+			expAttempts: 1,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			broker := NewMemoryBroker()
+			b := NewMemoryBus(broker, "group")
+
+			policy := RetryPolicy{
+				MaxAttempts:     3,
+				InitialBackoff:  time.Millisecond,
+				MaxBackoff:      time.Millisecond,
+				DeadLetterTopic: "purchase_dead_letter",
+			}
+
+			msg := models.Message{Key: []string{"a"}, Topic: "purchase", Payload: []byte(`{"id":`)}
+			assert.NoError(t, b.Publish(context.Background(), msg))
+
+			var attempts int
+			fail := func(context.Context, models.Message) error {
+				attempts++
+				return c.err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+			defer cancel()
+			b.NewConsumer("purchase", WithName("agent.test"), WithRetry(policy)).Run(ctx, fail)
+
+			assert.Equal(t, c.expAttempts, attempts)
+			assert.Equal(t, 1, b.Committed("purchase"))
+
+			dead := broker.topic("purchase_dead_letter").messages
+			if assert.Len(t, dead, 1) {
+				assert.Equal(t, msg.Key, dead[0].Key)
+				assert.Equal(t, msg.Payload, dead[0].Payload)
+				assert.Equal(t, map[string]string{
+					HeaderDeadLetterAgent:    "agent.test",
+					HeaderDeadLetterTopic:    "purchase",
+					HeaderDeadLetterStage:    StageHandle,
+					HeaderDeadLetterAttempts: strconv.Itoa(c.expAttempts),
+					HeaderDeadLetterError:    c.err.Error(),
+				}, dead[0].Headers)
+			}
+		})
+	}
+}
+
+// flakyBus fails to publish a number of times before publishing to its Bus.
+type flakyBus struct {
+	Bus
+	failures int
+}
+
+func (b *flakyBus) Publish(ctx context.Context, msg models.Message) error {
+	if b.failures > 0 {
+		b.failures--
+		return errors.New("broker unavailable")
+	}
+
+	return b.Bus.Publish(ctx, msg)
+}
+
+func TestRetryDeadLetterPublish(t *testing.T) {
+	broker := NewMemoryBroker()
+	pub := &flakyBus{Bus: NewMemoryBus(broker, "group"), failures: 2}
+
+	c := consumerConfig{name: "agent.test", retry: RetryPolicy{DeadLetterTopic: "purchase_dead_letter"}}
+	msg := models.Message{Key: []string{"a"}, Topic: "purchase"}
+
+	// Messages that can't be decoded are dead-lettered without being handled.
+	assert.NoError(t, c.deadLetter(context.Background(), pub, msg, StageDecode, 0, errors.New("invalid character")))
+	dead := broker.topic("purchase_dead_letter").messages
+	if assert.Len(t, dead, 1) {
+		assert.Equal(t, StageDecode, dead[0].Headers[HeaderDeadLetterStage])
+		assert.Equal(t, "0", dead[0].Headers[HeaderDeadLetterAttempts])
+	}
+
+	// Shutdown stops the retries, leaving the message uncommitted.
+	pub.failures = 1
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, c.deadLetter(ctx, pub, msg, StageHandle, 1, errors.New("database unavailable")))
+}
+
+func TestRetryWithoutDeadLetterTopic(t *testing.T) {
+	broker := NewMemoryBroker()
+	b := NewMemoryBus(broker, "group")
+
+	policy := RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+	assert.NoError(t, b.Publish(context.Background(), models.Message{Key: []string{"a"}, Topic: "purchase"}))
+
+	var attempts int
+	fail := func(context.Context, models.Message) error {
+		attempts++
+		return errors.New("database unavailable")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	b.NewConsumer("purchase", WithName("agent.test"), WithRetry(policy)).Run(ctx, fail)
+
+	// The message is given up on, but left uncommitted rather than dropped.
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, 0, b.Committed("purchase"))
+}
+
+func TestRetryDefer(t *testing.T) {
+	broker := NewMemoryBroker()
+	b := NewMemoryBus(broker, "group")
+
+	policy := RetryPolicy{MaxAttempts: 1, DeadLetterTopic: "purchase_dead_letter"}
+	assert.NoError(t, b.Publish(context.Background(), models.Message{Key: []string{"a"}, Topic: "purchase"}))
+
+	var attempts int
+	handle := func(context.Context, models.Message) error {
+		attempts++
+		if attempts < 3 {
+			return Defer(errors.New("llm circuit breaker is open"), time.Millisecond)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
+	defer cancel()
+	b.NewConsumer("purchase", WithName("agent.test"), WithRetry(policy)).Run(ctx, handle)
+
+	// Deferrals don't use up the single attempt.
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, 1, b.Committed("purchase"))
+	assert.Empty(t, broker.topic("purchase_dead_letter").messages)
+}
+
+func TestRetryMaxDeferral(t *testing.T) {
+	broker := NewMemoryBroker()
+	b := NewMemoryBus(broker, "group")
+
+	policy := RetryPolicy{
+		MaxAttempts:     2,
+		InitialBackoff:  time.Millisecond,
+		MaxDeferral:     time.Millisecond * 250,
+		DeadLetterTopic: "purchase_dead_letter",
+	}
+	assert.NoError(t, b.Publish(context.Background(), models.Message{Key: []string{"a"}, Topic: "purchase"}))
+
+	var attempts int
+	handle := func(context.Context, models.Message) error {
+		attempts++
+		return Defer(errors.New("llm circuit breaker is open"), time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	b.NewConsumer("purchase", WithName("agent.test"), WithRetry(policy)).Run(ctx, handle)
+
+	// Once the deferrals add up to MaxDeferral, they use up attempts, so a
+	// dependency that never recovers doesn't hold the message forever.
+	assert.Equal(t, 1, b.Committed("purchase"))
+	dead := broker.topic("purchase_dead_letter").messages
+	if assert.Len(t, dead, 1) {
+		assert.Equal(t, "2", dead[0].Headers[HeaderDeadLetterAttempts])
+	}
+	assert.Greater(t, attempts, 2)
+}
@@ -0,0 +1,63 @@
+package bus
+
+import (
+	"crdb/ai_ml/fraud_detection/app/pkg/metrics"
+	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"strconv"
+	"sync"
+)
+
+// watermarks tracks the resolved timestamp up to which a consumer has
+// processed every message, for each partition and across all of them.
+type watermarks struct {
+	name  string
+	topic string
+
+	mu         sync.Mutex
+	partitions map[int]models.HLC
+}
+
+func newWatermarks(name, topic string) *watermarks {
+	return &watermarks{
+		name:       name,
+		topic:      topic,
+		partitions: map[int]models.HLC{},
+	}
+}
+
+func (w *watermarks) resolve(partition int, ts models.HLC) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.partitions[partition].Less(ts) {
+		return
+	}
+	w.partitions[partition] = ts
+
+	metrics.Watermark.
+		WithLabelValues(w.name, w.topic, strconv.Itoa(partition)).
+		Set(float64(ts.WallTime) / 1e9)
+
+	metrics.GlobalWatermark.
+		WithLabelValues(w.name, w.topic).
+		Set(float64(w.globalLocked().WallTime) / 1e9)
+}
+
+// global returns the lowest watermark of the partitions seen so far.
+func (w *watermarks) global() models.HLC {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.globalLocked()
+}
+
+func (w *watermarks) globalLocked() models.HLC {
+	var low models.HLC
+	for _, ts := range w.partitions {
+		if low.IsZero() || ts.Less(low) {
+			low = ts
+		}
+	}
+
+	return low
+}
@@ -0,0 +1,46 @@
+package feedback
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// Register adds POST /feedback to a mux, which records a Feedback and
+// responds with the label it was given.
+func Register(mux *http.ServeMux, r Recorder) {
+	mux.HandleFunc("POST /feedback", func(w http.ResponseWriter, req *http.Request) {
+		var f Feedback
+		if err := json.NewDecoder(req.Body).Decode(&f); err != nil {
+			http.Error(w, "invalid feedback", http.StatusBadRequest)
+			return
+		}
+
+		if f.PurchaseID == "" || f.CustomerID == "" {
+			http.Error(w, "purchase_id and customer_id are required", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := f.resolve(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		label, err := r.Record(req.Context(), f)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			log.Printf("error recording feedback: %v", err)
+			http.Error(w, "error recording feedback", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err = json.NewEncoder(w).Encode(map[string]Label{"label": label}); err != nil {
+			log.Printf("error writing response: %v", err)
+		}
+	})
+}
@@ -0,0 +1,211 @@
+package feedback
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrNotFound = errors.New("anomaly not found")
+
+// Label is the ground truth for an anomaly.
+type Label string
+
+const (
+	// LabelConfirmedFraud is for purchases the customer didn't make. They're
+	// left out of baselines, so fraud doesn't become normal.
+	LabelConfirmedFraud Label = "confirmed_fraud"
+
+	// LabelFalsePositive is for purchases the customer made.
+	LabelFalsePositive Label = "false_positive"
+)
+
+func (l Label) validate() error {
+	switch l {
+	case LabelConfirmedFraud, LabelFalsePositive:
+		return nil
+	default:
+		return fmt.Errorf("unsupported label: %q", l)
+	}
+}
+
+// Source is who labelled an anomaly.
+type Source string
+
+const (
+	SourceCustomer Source = "customer"
+	SourceAnalyst  Source = "analyst"
+)
+
+// Feedback is a customer's response to being told about an anomaly. Either
+// Label or Reply is set, where Reply is their message, such as "yes, that was
+// me".
+type Feedback struct {
+	PurchaseID string `json:"purchase_id"`
+	CustomerID string `json:"customer_id"`
+	Label      Label  `json:"label,omitempty"`
+	Reply      string `json:"reply,omitempty"`
+}
+
+// resolve returns the feedback's label, interpreting the reply if there is
+// one.
+func (f Feedback) resolve() (Label, error) {
+	if f.Reply == "" {
+		return f.Label, f.Label.validate()
+	}
+
+	return ParseReply(f.Reply)
+}
+
+// Replies are judged by an explicit phrase anywhere in them, such as "that was
+// me", and failing that by a leading yes or no, so "No problem, that was me"
+// means the customer made the purchase. Denials are matched first and taken
+// out of the reply, so "I don't think that was me" isn't also read as "that
+// was me".
+var (
+	madeIt    = []string{"that was me", "it was me"}
+	didntMake = []string{
+		"not me",
+		"wasn't me", "was not me",
+		"don't think that was me", "do not think that was me",
+		"don't think it was me", "do not think it was me",
+	}
+
+	yes = []string{"yes", "y"}
+	no  = []string{"no", "n"}
+)
+
+// ParseReply interprets a customer's reply to the question of whether they
+// made a purchase. Replies that say both are rejected as ambiguous.
+func ParseReply(reply string) (Label, error) {
+	normalised := strings.ToLower(strings.TrimSpace(reply))
+	normalised = strings.ReplaceAll(normalised, "’", "'")
+
+	var didnt bool
+	rest := normalised
+	for _, p := range didntMake {
+		var found bool
+		if rest, found = removeWord(rest, p); found {
+			didnt = true
+		}
+	}
+
+	made := slices.ContainsFunc(madeIt, func(p string) bool { return containsWord(rest, p) })
+
+	switch {
+	case made && didnt:
+		return "", fmt.Errorf("ambiguous reply: %q", reply)
+	case made:
+		return LabelFalsePositive, nil
+	case didnt:
+		return LabelConfirmedFraud, nil
+	}
+
+	for _, p := range no {
+		if hasWord(normalised, p) {
+			return LabelConfirmedFraud, nil
+		}
+	}
+
+	for _, p := range yes {
+		if hasWord(normalised, p) {
+			return LabelFalsePositive, nil
+		}
+	}
+
+	return "", fmt.Errorf("unrecognised reply: %q", reply)
+}
+
+// hasWord reports whether s starts with the phrase, followed by the end of
+// the string or a non-letter, so "n" doesn't match "nice". s must be lower
+// case.
+func hasWord(s, phrase string) bool {
+	if !strings.HasPrefix(s, phrase) {
+		return false
+	}
+
+	rest := s[len(phrase):]
+	return rest == "" || !isLetter(rest[0])
+}
+
+// containsWord reports whether the phrase appears anywhere in s with a
+// non-letter, or nothing, either side of it. s must be lower case.
+func containsWord(s, phrase string) bool {
+	for i := 0; i < len(s); i++ {
+		if (i == 0 || !isLetter(s[i-1])) && hasWord(s[i:], phrase) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// removeWord replaces every occurrence of the phrase that containsWord would
+// match with a space, reporting whether there were any. s must be lower case.
+func removeWord(s, phrase string) (string, bool) {
+	var b strings.Builder
+	var found bool
+
+	for i := 0; i < len(s); i++ {
+		if (i == 0 || !isLetter(s[i-1])) && hasWord(s[i:], phrase) {
+			b.WriteByte(' ')
+			i += len(phrase) - 1
+			found = true
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String(), found
+}
+
+func isLetter(b byte) bool {
+	return b >= 'a' && b <= 'z'
+}
+
+// Recorder records customer feedback, returning the label it was given.
+type Recorder interface {
+	Record(ctx context.Context, f Feedback) (Label, error)
+}
+
+// Store records labels against anomalies in the database.
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+// Record labels an anomaly with the customer's feedback, replacing any label
+// an analyst has given it, as the customer knows best.
+func (s *Store) Record(ctx context.Context, f Feedback) (Label, error) {
+	label, err := f.resolve()
+	if err != nil {
+		return "", err
+	}
+
+	const stmt = `UPDATE anomaly
+		SET label = $3, label_source = $4, labelled_at = now()
+		WHERE purchase_id = $1 AND customer_id = $2`
+
+	res, err := s.db.ExecContext(ctx, stmt, f.PurchaseID, f.CustomerID, string(label), string(SourceCustomer))
+	if err != nil {
+		return "", fmt.Errorf("executing query: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("checking anomaly: %w", err)
+	}
+	if n == 0 {
+		return "", ErrNotFound
+	}
+
+	return label, nil
+}
@@ -0,0 +1,128 @@
+package feedback
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReply(t *testing.T) {
+	cases := []struct {
+		reply   string
+		exp     Label
+		wantErr bool
+	}{
+		{reply: "Yes", exp: LabelFalsePositive},
+		{reply: "yes, that was me", exp: LabelFalsePositive},
+		{reply: "  Y ", exp: LabelFalsePositive},
+		{reply: "That was me!", exp: LabelFalsePositive},
+		{reply: "NO", exp: LabelConfirmedFraud},
+		{reply: "no, that wasn't me", exp: LabelConfirmedFraud},
+		{reply: "That wasn’t me", exp: LabelConfirmedFraud},
+		{reply: "not me", exp: LabelConfirmedFraud},
+		{reply: "No problem, that was me", exp: LabelFalsePositive},
+		{reply: "No worries, it was me", exp: LabelFalsePositive},
+		{reply: "Yes, I got the text. It wasn't me", exp: LabelConfirmedFraud},
+		{reply: "I don't think that was me", exp: LabelConfirmedFraud},
+		{reply: "I don’t think it was me", exp: LabelConfirmedFraud},
+		{reply: "Yes, I do not think that was me", exp: LabelConfirmedFraud},
+		{reply: "wasn't me", exp: LabelConfirmedFraud},
+		{reply: "Hmm, that was not me", exp: LabelConfirmedFraud},
+		{reply: "that was me, no wait, it wasn't me", wantErr: true},
+		{reply: "I don't think that was me, actually it was me", wantErr: true},
+		{reply: "nice", wantErr: true},
+		{reply: "who is this?", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.reply, func(t *testing.T) {
+			act, err := ParseReply(c.reply)
+			if c.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.exp, act)
+		})
+	}
+}
+
+type memoryRecorder struct {
+	labels map[string]Label
+}
+
+func (r *memoryRecorder) Record(ctx context.Context, f Feedback) (Label, error) {
+	if _, ok := r.labels[f.PurchaseID]; !ok {
+		return "", ErrNotFound
+	}
+
+	label, err := f.resolve()
+	if err != nil {
+		return "", err
+	}
+
+	r.labels[f.PurchaseID] = label
+	return label, nil
+}
+
+func TestRegister(t *testing.T) {
+	r := &memoryRecorder{labels: map[string]Label{"p1": ""}}
+
+	mux := http.NewServeMux()
+	Register(mux, r)
+
+	cases := []struct {
+		name       string
+		body       string
+		expStatus  int
+		expBody    string
+		expLabelP1 Label
+	}{
+		{
+			name:       "reply",
+			body:       `{"purchase_id": "p1", "customer_id": "c1", "reply": "Yes, that was me"}`,
+			expStatus:  http.StatusOK,
+			expBody:    `{"label":"false_positive"}`,
+			expLabelP1: LabelFalsePositive,
+		},
+		{
+			name:       "label",
+			body:       `{"purchase_id": "p1", "customer_id": "c1", "label": "confirmed_fraud"}`,
+			expStatus:  http.StatusOK,
+			expBody:    `{"label":"confirmed_fraud"}`,
+			expLabelP1: LabelConfirmedFraud,
+		},
+		{
+			name:       "unsupported label",
+			body:       `{"purchase_id": "p1", "customer_id": "c1", "label": "maybe"}`,
+			expStatus:  http.StatusBadRequest,
+			expLabelP1: LabelConfirmedFraud,
+		},
+		{
+			name:       "unknown anomaly",
+			body:       `{"purchase_id": "p2", "customer_id": "c1", "reply": "no"}`,
+			expStatus:  http.StatusNotFound,
+			expLabelP1: LabelConfirmedFraud,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/feedback", strings.NewReader(c.body))
+			resp := httptest.NewRecorder()
+
+			mux.ServeHTTP(resp, req)
+
+			assert.Equal(t, c.expStatus, resp.Code)
+			if c.expBody != "" {
+				assert.JSONEq(t, c.expBody, resp.Body.String())
+			}
+			assert.Equal(t, c.expLabelP1, r.labels["p1"])
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// checkTimeout bounds how long a readiness check can take.
+const checkTimeout = time.Second * 2
+
+// Check returns an error if a dependency isn't ready.
+type Check func(ctx context.Context) error
+
+// Checker serves liveness and readiness endpoints. The process is live for as
+// long as it can serve requests, and ready when all of its checks pass.
+type Checker struct {
+	mu     sync.Mutex
+	names  []string
+	checks map[string]Check
+}
+
+func NewChecker() *Checker {
+	return &Checker{
+		checks: map[string]Check{},
+	}
+}
+
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.names = append(c.names, name)
+	c.checks[name] = check
+}
+
+// Register adds the /healthz and /readyz endpoints to a mux.
+func (c *Checker) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", c.healthz)
+	mux.HandleFunc("/readyz", c.readyz)
+}
+
+func (c *Checker) healthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+func (c *Checker) readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	c.mu.Lock()
+	names := append([]string{}, c.names...)
+	c.mu.Unlock()
+
+	status := http.StatusOK
+	results := map[string]string{}
+
+	for _, name := range names {
+		if err := c.checks[name](ctx); err != nil {
+			status = http.StatusServiceUnavailable
+			results[name] = err.Error()
+			continue
+		}
+
+		results[name] = "ok"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		log.Printf("error writing readiness response: %v", err)
+	}
+}
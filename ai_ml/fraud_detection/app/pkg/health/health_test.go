@@ -0,0 +1,45 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadyz(t *testing.T) {
+	var dbErr error
+
+	c := NewChecker()
+	c.Add("database", func(ctx context.Context) error { return dbErr })
+	c.Add("bus", func(ctx context.Context) error { return nil })
+
+	mux := http.NewServeMux()
+	c.Register(mux)
+
+	get := func(path string) (int, map[string]string) {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		var body map[string]string
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+
+	code, body := get("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]string{"database": "ok", "bus": "ok"}, body)
+
+	dbErr = errors.New("connection refused")
+	code, body = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, map[string]string{"database": "connection refused", "bus": "ok"}, body)
+
+	// Liveness doesn't depend on the checks.
+	code, _ = get("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+}
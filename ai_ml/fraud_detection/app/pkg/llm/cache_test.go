@@ -0,0 +1,33 @@
+package llm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Now()
+	c := NewCache(2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Add("a", "1")
+	c.Add("b", "2")
+
+	// Reading a makes b the least recently used, so it's evicted.
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+
+	c.Add("c", "3")
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+
+	resp, ok := c.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, "3", resp)
+
+	now = now.Add(2 * time.Minute)
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+}
@@ -0,0 +1,118 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// Fake returns a canned response without calling a model, for running agents
+// locally and in tests. Unless Response is set, the response is derived from
+// the prompt, so the same prompt always gets the same response.
+type Fake struct {
+	Response string
+	Err      error
+
+	mu      sync.Mutex
+	prompts []string
+}
+
+func (f *Fake) Complete(ctx context.Context, prompt string) (string, error) {
+	if err := f.record(prompt); err != nil {
+		return "", err
+	}
+
+	if f.Response != "" {
+		return f.Response, nil
+	}
+
+	return fakeText(prompt), nil
+}
+
+// CompleteJSON returns Response if it's set, or otherwise an object matching
+// the schema, using the first value of any enums.
+func (f *Fake) CompleteJSON(ctx context.Context, prompt string, schema Schema) (string, error) {
+	if err := f.record(prompt); err != nil {
+		return "", err
+	}
+
+	if f.Response != "" {
+		return f.Response, nil
+	}
+
+	// Round-trip the schema, so it's made of the same types whether it was
+	// written with []string or []any enums.
+	b, err := json.Marshal(schema.Schema)
+	if err != nil {
+		return "", fmt.Errorf("encoding schema: %w", err)
+	}
+
+	var s map[string]any
+	if err = json.Unmarshal(b, &s); err != nil {
+		return "", fmt.Errorf("decoding schema: %w", err)
+	}
+
+	b, err = json.Marshal(fakeValue(s, fakeText(prompt)))
+	if err != nil {
+		return "", fmt.Errorf("encoding response: %w", err)
+	}
+
+	return string(b), nil
+}
+
+func (f *Fake) record(prompt string) error {
+	f.mu.Lock()
+	f.prompts = append(f.prompts, prompt)
+	f.mu.Unlock()
+
+	return f.Err
+}
+
+func fakeText(prompt string) string {
+	h := fnv.New32a()
+	h.Write([]byte(prompt))
+
+	return fmt.Sprintf("[fake response %08x]", h.Sum32())
+}
+
+func fakeValue(schema map[string]any, text string) any {
+	if enum, ok := schema["enum"].([]any); ok && len(enum) > 0 {
+		return enum[0]
+	}
+
+	switch schema["type"] {
+	case "object":
+		obj := map[string]any{}
+		properties, _ := schema["properties"].(map[string]any)
+		for name, p := range properties {
+			property, _ := p.(map[string]any)
+			obj[name] = fakeValue(property, text)
+		}
+		return obj
+
+	case "array":
+		return []any{}
+
+	case "number":
+		return 0.5
+
+	case "integer":
+		return 0
+
+	case "boolean":
+		return false
+
+	default:
+		return text
+	}
+}
+
+// Prompts returns the prompts the fake has been asked to complete.
+func (f *Fake) Prompts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string{}, f.prompts...)
+}
@@ -2,22 +2,114 @@ package llm
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 )
 
+// ErrRejected wraps errors for requests that a provider has rejected, such as
+// for an invalid API key or request, which retrying won't fix.
+var ErrRejected = errors.New("llm request rejected")
+
+// Client completes a prompt with a language model.
 type Client interface {
 	Complete(ctx context.Context, prompt string) (string, error)
+
+	// CompleteJSON asks for a JSON object matching schema. Providers that
+	// support structured output enforce the schema, but the response should
+	// still be validated.
+	CompleteJSON(ctx context.Context, prompt string, schema Schema) (string, error)
+}
+
+// Schema is a named JSON schema for a structured completion.
+type Schema struct {
+	Name   string
+	Schema map[string]any
+}
+
+// Provider selects the Client implementation to use.
+type Provider string
+
+const (
+	ProviderOpenAI Provider = "openai"
+	ProviderLocal  Provider = "local"
+	ProviderFake   Provider = "fake"
+)
+
+// Config holds the settings for every provider; each uses the fields it needs.
+type Config struct {
+	Provider Provider
+	Model    string
+	BaseURL  string
+	APIKey   string
+
+	// RateLimit is the number of requests allowed per second, with up to
+	// RateBurst at once. Zero disables rate limiting.
+	RateLimit float64
+	RateBurst int
+
+	// Timeout limits each request. Zero disables it.
+	Timeout time.Duration
+
+	// BreakerFailures is the number of consecutive failures after which
+	// requests fail fast for BreakerCooldown. Zero disables circuit breaking.
+	BreakerFailures int
+	BreakerCooldown time.Duration
 }
 
-type noop struct {
-	endpoint string
-	key      string
+// NewClient returns a client for the provider, wrapped so that requests wait
+// for the rate limiter, then fail fast while the circuit breaker is open, and
+// then time out.
+func NewClient(cfg Config) (Client, error) {
+	c, err := newProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Timeout > 0 {
+		c = NewTimeout(c, cfg.Timeout)
+	}
+
+	if cfg.BreakerFailures > 0 {
+		c = NewCircuitBreaker(c, cfg.BreakerFailures, cfg.BreakerCooldown)
+	}
+
+	if cfg.RateLimit > 0 {
+		c = NewRateLimited(c, cfg.RateLimit, cfg.RateBurst)
+	}
+
+	return c, nil
 }
 
-func NewClient(endpoint, key string) Client {
-	return &noop{endpoint: endpoint, key: key}
+func newProvider(cfg Config) (Client, error) {
+	switch cfg.Provider {
+	case ProviderOpenAI:
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("an api key is required for the %s provider", cfg.Provider)
+		}
+		return NewOpenAI(cfg.APIKey, cfg.Model), nil
+
+	case ProviderLocal:
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("a base url is required for the %s provider", cfg.Provider)
+		}
+		return NewLocal(cfg.BaseURL, cfg.Model), nil
+
+	case ProviderFake:
+		return &Fake{}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported llm provider: %q", cfg.Provider)
+	}
 }
 
-func (n *noop) Complete(ctx context.Context, prompt string) (string, error) {
-	// TODO: replace with actual provider (OpenAI/Claude/local inference)
-	return "[LLM placeholder response]", nil
+// Ready returns an error if a client can't currently serve requests. Clients
+// that can check their provider do so by implementing a Ready method.
+func Ready(ctx context.Context, c Client) error {
+	r, ok := c.(interface{ Ready(context.Context) error })
+	if !ok {
+		return nil
+	}
+
+	return r.Ready(ctx)
 }
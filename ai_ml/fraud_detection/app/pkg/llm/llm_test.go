@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewClient(t *testing.T) {
+	_, err := NewClient(Config{Provider: ProviderOpenAI, Model: "gpt-4o"})
+	assert.Error(t, err)
+
+	_, err = NewClient(Config{Provider: ProviderLocal, Model: "llama3.1"})
+	assert.Error(t, err)
+
+	_, err = NewClient(Config{Provider: "claude"})
+	assert.Error(t, err)
+
+	c, err := NewClient(Config{Provider: ProviderLocal, Model: "llama3.1", BaseURL: "http://localhost:11434/v1"})
+	assert.NoError(t, err)
+	assert.IsType(t, &OpenAI{}, c)
+
+	c, err = NewClient(Config{Provider: ProviderFake})
+	assert.NoError(t, err)
+	assert.NoError(t, Ready(context.Background(), c))
+}
+
+func TestFake(t *testing.T) {
+	f := &Fake{}
+
+	a, err := f.Complete(context.Background(), "prompt a")
+	assert.NoError(t, err)
+
+	again, err := f.Complete(context.Background(), "prompt a")
+	assert.NoError(t, err)
+	assert.Equal(t, a, again)
+
+	b, err := f.Complete(context.Background(), "prompt b")
+	assert.NoError(t, err)
+	assert.NotEqual(t, a, b)
+
+	assert.Equal(t, []string{"prompt a", "prompt a", "prompt b"}, f.Prompts())
+}
+
+func TestFakeCompleteJSON(t *testing.T) {
+	f := &Fake{}
+
+	schema := Schema{
+		Name: "verdict",
+		Schema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"reason":     map[string]any{"type": "string"},
+				"confidence": map[string]any{"type": "number"},
+				"action":     map[string]any{"type": "string", "enum": []string{"block", "ignore"}},
+			},
+		},
+	}
+
+	resp, err := f.CompleteJSON(context.Background(), "prompt", schema)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"reason": "[fake response dfe6493b]", "confidence": 0.5, "action": "block"}`, resp)
+}
@@ -0,0 +1,230 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+var (
+	// ErrCircuitOpen is returned without calling the provider while a
+	// circuit breaker is open.
+	ErrCircuitOpen = errors.New("llm circuit breaker is open")
+
+	// ErrRateLimited is returned without calling the provider when waiting
+	// for the rate limiter would outlast the request's deadline.
+	ErrRateLimited = errors.New("llm rate limit reached")
+)
+
+// probeWait is how long to wait for a circuit breaker's probe to finish.
+const probeWait = time.Second
+
+// UnavailableError wraps ErrCircuitOpen or ErrRateLimited with how long to wait
+// before a request might be made, so callers can hold off rather than fail.
+type UnavailableError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%v (retry after %s)", e.Err, e.RetryAfter)
+}
+
+func (e *UnavailableError) Unwrap() error { return e.Err }
+
+// call is a request to a Client, made with the given context.
+type call func(ctx context.Context) (string, error)
+
+// ready forwards readiness checks to the wrapped client.
+type ready struct {
+	next Client
+}
+
+func (r ready) Ready(ctx context.Context) error {
+	return Ready(ctx, r.next)
+}
+
+// RateLimited waits for a token before each request, so that bursts of
+// anomalies don't exceed the provider's rate limits. Requests that can't get
+// one before their deadline fail straight away with ErrRateLimited.
+type RateLimited struct {
+	ready
+	limiter *rate.Limiter
+}
+
+// NewRateLimited allows perSecond requests on average, and up to burst at
+// once.
+func NewRateLimited(next Client, perSecond float64, burst int) *RateLimited {
+	return &RateLimited{
+		ready:   ready{next: next},
+		limiter: rate.NewLimiter(rate.Limit(perSecond), max(burst, 1)),
+	}
+}
+
+func (c *RateLimited) Complete(ctx context.Context, prompt string) (string, error) {
+	return c.do(ctx, func(ctx context.Context) (string, error) {
+		return c.next.Complete(ctx, prompt)
+	})
+}
+
+func (c *RateLimited) CompleteJSON(ctx context.Context, prompt string, schema Schema) (string, error) {
+	return c.do(ctx, func(ctx context.Context) (string, error) {
+		return c.next.CompleteJSON(ctx, prompt, schema)
+	})
+}
+
+func (c *RateLimited) do(ctx context.Context, f call) (string, error) {
+	r := c.limiter.Reserve()
+	delay := r.Delay()
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		r.Cancel()
+		return "", &UnavailableError{Err: ErrRateLimited, RetryAfter: delay}
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		r.Cancel()
+		return "", fmt.Errorf("waiting for rate limiter: %w", ctx.Err())
+	case <-t.C:
+	}
+
+	return f(ctx)
+}
+
+// Timeout limits how long each request can take.
+type Timeout struct {
+	ready
+	timeout time.Duration
+}
+
+func NewTimeout(next Client, timeout time.Duration) *Timeout {
+	return &Timeout{
+		ready:   ready{next: next},
+		timeout: timeout,
+	}
+}
+
+func (c *Timeout) Complete(ctx context.Context, prompt string) (string, error) {
+	return c.do(ctx, func(ctx context.Context) (string, error) {
+		return c.next.Complete(ctx, prompt)
+	})
+}
+
+func (c *Timeout) CompleteJSON(ctx context.Context, prompt string, schema Schema) (string, error) {
+	return c.do(ctx, func(ctx context.Context) (string, error) {
+		return c.next.CompleteJSON(ctx, prompt, schema)
+	})
+}
+
+func (c *Timeout) do(ctx context.Context, f call) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return f(ctx)
+}
+
+// CircuitBreaker stops calling the provider after a number of consecutive
+// failures, returning ErrCircuitOpen until the cooldown has passed. A single
+// request is then let through, closing the circuit if it succeeds and
+// reopening it if it doesn't. Requests the provider rejects with ErrRejected
+// show that it's up, so they count as successes.
+type CircuitBreaker struct {
+	ready
+	failures int
+	cooldown time.Duration
+	now      func() time.Time
+
+	mu          sync.Mutex
+	consecutive int
+	openedAt    time.Time
+	probing     bool
+}
+
+func NewCircuitBreaker(next Client, failures int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		ready:    ready{next: next},
+		failures: max(failures, 1),
+		cooldown: cooldown,
+		now:      time.Now,
+	}
+}
+
+func (c *CircuitBreaker) Complete(ctx context.Context, prompt string) (string, error) {
+	return c.do(ctx, func(ctx context.Context) (string, error) {
+		return c.next.Complete(ctx, prompt)
+	})
+}
+
+func (c *CircuitBreaker) CompleteJSON(ctx context.Context, prompt string, schema Schema) (string, error) {
+	return c.do(ctx, func(ctx context.Context) (string, error) {
+		return c.next.CompleteJSON(ctx, prompt, schema)
+	})
+}
+
+func (c *CircuitBreaker) do(ctx context.Context, f call) (string, error) {
+	if err := c.allow(); err != nil {
+		return "", err
+	}
+
+	resp, err := f(ctx)
+
+	// Requests abandoned by the caller say nothing about the provider.
+	if err != nil && ctx.Err() != nil {
+		c.mu.Lock()
+		c.probing = false
+		c.mu.Unlock()
+		return "", err
+	}
+
+	c.record(err)
+	return resp, err
+}
+
+func (c *CircuitBreaker) allow() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.consecutive < c.failures {
+		return nil
+	}
+
+	if c.probing {
+		return &UnavailableError{Err: ErrCircuitOpen, RetryAfter: probeWait}
+	}
+
+	if remaining := c.cooldown - c.now().Sub(c.openedAt); remaining > 0 {
+		return &UnavailableError{Err: ErrCircuitOpen, RetryAfter: remaining}
+	}
+
+	c.probing = true
+	return nil
+}
+
+func (c *CircuitBreaker) record(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.probing = false
+
+	if err == nil || errors.Is(err, ErrRejected) {
+		c.consecutive = 0
+		return
+	}
+
+	c.consecutive++
+	if c.consecutive >= c.failures {
+		if c.consecutive == c.failures {
+			log.Printf("opening llm circuit breaker after %d consecutive failures", c.consecutive)
+		}
+		c.openedAt = c.now()
+	}
+}
@@ -0,0 +1,122 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	f := &Fake{Err: errors.New("provider unavailable")}
+
+	now := time.Now()
+	c := NewCircuitBreaker(f, 2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	for range 2 {
+		_, err := c.Complete(context.Background(), "prompt")
+		assert.EqualError(t, err, "provider unavailable")
+	}
+
+	// Open: the provider isn't called.
+	now = now.Add(time.Second * 20)
+	_, err := c.Complete(context.Background(), "prompt")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Len(t, f.Prompts(), 2)
+
+	var unavailable *UnavailableError
+	if assert.ErrorAs(t, err, &unavailable) {
+		assert.Equal(t, time.Second*40, unavailable.RetryAfter)
+	}
+
+	// Half-open: a failed request reopens it.
+	now = now.Add(time.Second * 40)
+	_, err = c.Complete(context.Background(), "prompt")
+	assert.EqualError(t, err, "provider unavailable")
+
+	_, err = c.Complete(context.Background(), "prompt")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	// Half-open: a successful request closes it.
+	now = now.Add(time.Minute)
+	f.Err = nil
+
+	_, err = c.Complete(context.Background(), "prompt")
+	assert.NoError(t, err)
+
+	_, err = c.Complete(context.Background(), "prompt")
+	assert.NoError(t, err)
+	assert.Len(t, f.Prompts(), 5)
+
+	// Rejected requests, such as for an invalid API key, don't open it.
+	f.Err = fmt.Errorf("%w: 401 Unauthorized", ErrRejected)
+	for range 3 {
+		_, err = c.Complete(context.Background(), "prompt")
+		assert.ErrorIs(t, err, ErrRejected)
+	}
+	assert.Len(t, f.Prompts(), 8)
+}
+
+func TestRejected(t *testing.T) {
+	assert.True(t, rejected(http.StatusUnauthorized))
+	assert.True(t, rejected(http.StatusBadRequest))
+	assert.False(t, rejected(http.StatusTooManyRequests))
+	assert.False(t, rejected(http.StatusRequestTimeout))
+	assert.False(t, rejected(http.StatusInternalServerError))
+}
+
+type slow struct {
+	Fake
+}
+
+func (s *slow) Complete(ctx context.Context, prompt string) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestTimeout(t *testing.T) {
+	c := NewTimeout(&slow{}, time.Millisecond)
+
+	_, err := c.Complete(context.Background(), "prompt")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRateLimited(t *testing.T) {
+	c := NewRateLimited(&Fake{}, 1, 1)
+
+	_, err := c.Complete(context.Background(), "prompt")
+	assert.NoError(t, err)
+
+	// The next token is a second away, after the deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	_, err = c.Complete(ctx, "prompt")
+	assert.ErrorIs(t, err, ErrRateLimited)
+
+	var unavailable *UnavailableError
+	if assert.ErrorAs(t, err, &unavailable) {
+		assert.InDelta(t, time.Second, unavailable.RetryAfter, float64(time.Millisecond*100))
+	}
+}
+
+func TestNewClientWraps(t *testing.T) {
+	c, err := NewClient(Config{
+		Provider:        ProviderFake,
+		RateLimit:       10,
+		Timeout:         time.Second,
+		BreakerFailures: 5,
+	})
+	assert.NoError(t, err)
+	assert.IsType(t, &RateLimited{}, c)
+	assert.NoError(t, Ready(context.Background(), c))
+
+	resp, err := c.CompleteJSON(context.Background(), "prompt", Schema{Schema: map[string]any{"type": "string"}})
+	assert.NoError(t, err)
+	assert.Equal(t, `"[fake response dfe6493b]"`, resp)
+}
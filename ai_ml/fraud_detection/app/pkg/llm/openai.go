@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/option"
+	"github.com/openai/openai-go/v3/shared"
+)
+
+// OpenAI completes prompts with the OpenAI chat completions API, or any
+// server that implements it.
+type OpenAI struct {
+	client openai.Client
+	model  string
+	local  bool
+}
+
+func NewOpenAI(key, model string) *OpenAI {
+	return &OpenAI{
+		client: openai.NewClient(option.WithAPIKey(key)),
+		model:  model,
+	}
+}
+
+// NewLocal returns a client for an OpenAI-compatible endpoint, such as
+// Ollama's http://localhost:11434/v1. These don't require an API key.
+func NewLocal(baseURL, model string) *OpenAI {
+	return &OpenAI{
+		client: openai.NewClient(option.WithBaseURL(baseURL), option.WithAPIKey("local")),
+		model:  model,
+		local:  true,
+	}
+}
+
+func (c *OpenAI) Complete(ctx context.Context, prompt string) (string, error) {
+	return c.complete(ctx, openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.UserMessage(prompt),
+		},
+		Model: c.model,
+	})
+}
+
+func (c *OpenAI) CompleteJSON(ctx context.Context, prompt string, schema Schema) (string, error) {
+	return c.complete(ctx, openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.UserMessage(prompt),
+		},
+		Model: c.model,
+		ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONSchema: &shared.ResponseFormatJSONSchemaParam{
+				JSONSchema: shared.ResponseFormatJSONSchemaJSONSchemaParam{
+					Name:   schema.Name,
+					Schema: schema.Schema,
+					Strict: openai.Bool(true),
+				},
+			},
+		},
+	})
+}
+
+func (c *OpenAI) complete(ctx context.Context, params openai.ChatCompletionNewParams) (string, error) {
+	resp, err := c.client.Chat.Completions.New(ctx, params)
+
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) && rejected(apiErr.StatusCode) {
+		return "", fmt.Errorf("creating chat completion: %w: %w", ErrRejected, err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("creating chat completion: %w", err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return "", errors.New("empty chat completion")
+	}
+
+	return resp.Choices[0].Message.Content, nil
+}
+
+// Ready checks that a local endpoint is serving the model. OpenAI itself is
+// assumed to be available, rather than spending API calls on readiness.
+func (c *OpenAI) Ready(ctx context.Context) error {
+	if !c.local {
+		return nil
+	}
+
+	if _, err := c.client.Models.Get(ctx, c.model); err != nil {
+		return fmt.Errorf("getting model %q: %w", c.model, err)
+	}
+
+	return nil
+}
+
+// rejected reports whether a response status means the request can't succeed
+// however many times it's made. Timeouts, conflicts and rate limits can.
+func rejected(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return false
+	default:
+		return status >= 400 && status < 500
+	}
+}
@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "fraud_agent"
+
+var (
+	// Watermark is the resolved timestamp, in Unix seconds, up to which an
+	// agent has processed every message in a partition.
+	Watermark = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "watermark_seconds",
+		Help:      "Resolved timestamp up to which a partition has been processed.",
+	}, []string{"agent", "topic", "partition"})
+
+	// GlobalWatermark is the lowest Watermark across an agent's partitions.
+	GlobalWatermark = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "global_watermark_seconds",
+		Help:      "Resolved timestamp up to which every partition has been processed.",
+	}, []string{"agent", "topic"})
+
+	// EndToEndLag is the time between a row change being committed and an
+	// agent finishing processing it.
+	EndToEndLag = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "end_to_end_lag_seconds",
+		Help:      "Time from a row change being committed to an agent processing it.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"agent"})
+
+	MessagesConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_consumed_total",
+		Help:      "Messages fetched from the bus.",
+	}, []string{"agent"})
+
+	MessagesProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_processed_total",
+		Help:      "Messages handled successfully.",
+	}, []string{"agent"})
+
+	// MessagesFailed counts failed attempts, so a message that's retried
+	// before succeeding still counts towards it.
+	MessagesFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_failed_total",
+		Help:      "Attempts at handling a message that returned an error.",
+	}, []string{"agent"})
+
+	MessagesDeadLettered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_dead_lettered_total",
+		Help:      "Messages given up on and sent to the dead-letter topic.",
+	}, []string{"agent"})
+
+	// MessagesAbandoned counts messages given up on by consumers without a
+	// dead-letter topic, which are left uncommitted rather than dropped.
+	MessagesAbandoned = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_abandoned_total",
+		Help:      "Messages given up on without a dead-letter topic, and left uncommitted.",
+	}, []string{"agent"})
+
+	ProcessingLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "processing_latency_seconds",
+		Help:      "Time taken to handle a message, including retries.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"agent"})
+
+	QueryLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_latency_seconds",
+		Help:      "Time taken by database queries.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"agent", "query"})
+
+	LLMLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "llm_latency_seconds",
+		Help:      "Time taken by LLM requests.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 10),
+	}, []string{"agent"})
+
+	// LLMInvalidResponses counts responses that didn't match the schema they
+	// were asked for, each of which is retried.
+	LLMInvalidResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_invalid_responses_total",
+		Help:      "LLM responses that failed validation.",
+	}, []string{"agent"})
+
+	LLMCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_cache_lookups_total",
+		Help:      "Lookups of cached LLM responses, by whether they were found.",
+	}, []string{"agent", "result"})
+
+	ConsumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "consumer_lag",
+		Help:      "Messages in a topic that the agent has yet to consume.",
+	}, []string{"agent", "topic"})
+)
+
+// ObserveQuery records how long a database query has taken since start. Use
+// it with defer.
+func ObserveQuery(agent, query string, start time.Time) {
+	QueryLatency.WithLabelValues(agent, query).Observe(time.Since(start).Seconds())
+}
+
+// ObserveLLM records how long an LLM request has taken since start. Use it
+// with defer.
+func ObserveLLM(agent string, start time.Time) {
+	LLMLatency.WithLabelValues(agent).Observe(time.Since(start).Seconds())
+}
@@ -1,9 +1,74 @@
 package models
 
+import (
+	"fmt"
+	"strings"
+)
+
 type AgentType string
 
 const (
 	AgentTypeAnomalyDetection AgentType = "anomaly_detection"
 	AgentTypeReasoning        AgentType = "reasoning"
 	AgentTypeNotification     AgentType = "notification"
+
+	// AgentTypeAll runs every agent in a single process.
+	AgentTypeAll AgentType = "all"
 )
+
+// AgentTypes lists every agent, in pipeline order.
+var AgentTypes = []AgentType{
+	AgentTypeAnomalyDetection,
+	AgentTypeReasoning,
+	AgentTypeNotification,
+}
+
+// ParseAgentTypes parses a comma-separated list of agent types, or "all".
+func ParseAgentTypes(s string) ([]AgentType, error) {
+	var types []AgentType
+	seen := map[AgentType]bool{}
+
+	for _, part := range strings.Split(s, ",") {
+		t := AgentType(strings.TrimSpace(part))
+
+		switch t {
+		case AgentTypeAll:
+			return AgentTypes, nil
+		case AgentTypeAnomalyDetection, AgentTypeReasoning, AgentTypeNotification:
+		default:
+			return nil, fmt.Errorf("unsupported agent type: %q", t)
+		}
+
+		if !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+
+	return types, nil
+}
+
+// Topic is the topic an agent consumes, which is fed by the changefeed on the
+// table before it in the pipeline.
+func (t AgentType) Topic() string {
+	switch t {
+	case AgentTypeAnomalyDetection:
+		return "purchase"
+	case AgentTypeReasoning:
+		return "anomaly"
+	case AgentTypeNotification:
+		return "notification"
+	default:
+		return ""
+	}
+}
+
+// GroupID is the consumer group an agent joins, shared by its replicas.
+func (t AgentType) GroupID() string {
+	return string(t)
+}
+
+// DeadLetterTopic is where an agent sends messages it has given up on.
+func (t AgentType) DeadLetterTopic() string {
+	return string(t) + "_dead_letter"
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAgentTypes(t *testing.T) {
+	types, err := ParseAgentTypes("all")
+	assert.NoError(t, err)
+	assert.Equal(t, AgentTypes, types)
+
+	types, err = ParseAgentTypes("reasoning")
+	assert.NoError(t, err)
+	assert.Equal(t, []AgentType{AgentTypeReasoning}, types)
+
+	types, err = ParseAgentTypes("notification, anomaly_detection,notification")
+	assert.NoError(t, err)
+	assert.Equal(t, []AgentType{AgentTypeNotification, AgentTypeAnomalyDetection}, types)
+
+	_, err = ParseAgentTypes("reasoning,explaining")
+	assert.EqualError(t, err, `unsupported agent type: "explaining"`)
+
+	_, err = ParseAgentTypes("")
+	assert.Error(t, err)
+}
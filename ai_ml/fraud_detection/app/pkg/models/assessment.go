@@ -0,0 +1,102 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Action is what the reasoning agent recommends doing about an anomalous
+// purchase.
+type Action string
+
+const (
+	ActionBlock  Action = "block"
+	ActionVerify Action = "verify"
+	ActionIgnore Action = "ignore"
+)
+
+// Assessment is the reasoning agent's structured verdict on an anomaly.
+type Assessment struct {
+	PrimaryReason string  `json:"primary_reason"`
+	Message       string  `json:"message"`
+	Confidence    float64 `json:"confidence"`
+	Action        Action  `json:"action"`
+}
+
+// AssessmentSchema is the JSON schema an LLM's assessment must match.
+var AssessmentSchema = map[string]any{
+	"type":                 "object",
+	"additionalProperties": false,
+	"required":             []string{"primary_reason", "message", "confidence", "action"},
+	"properties": map[string]any{
+		"primary_reason": map[string]any{
+			"type":        "string",
+			"description": "The main reason the purchase was flagged, for internal use.",
+		},
+		"message": map[string]any{
+			"type":        "string",
+			"description": "A brief message to the customer explaining why their purchase was flagged.",
+		},
+		"confidence": map[string]any{
+			"type":        "number",
+			"description": "How confident you are that the purchase is fraudulent, from 0 to 1.",
+			"minimum":     0,
+			"maximum":     1,
+		},
+		"action": map[string]any{
+			"type":        "string",
+			"description": "What to do about the purchase.",
+			"enum":        []Action{ActionBlock, ActionVerify, ActionIgnore},
+		},
+	},
+}
+
+// ParseAssessment decodes an LLM's response, returning an error if it
+// doesn't match AssessmentSchema.
+func ParseAssessment(s string) (Assessment, error) {
+	var raw struct {
+		PrimaryReason *string  `json:"primary_reason"`
+		Message       *string  `json:"message"`
+		Confidence    *float64 `json:"confidence"`
+		Action        *Action  `json:"action"`
+	}
+
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&raw); err != nil {
+		return Assessment{}, fmt.Errorf("decoding assessment: %w", err)
+	}
+	if dec.More() {
+		return Assessment{}, errors.New("unexpected data after assessment")
+	}
+
+	switch {
+	case raw.PrimaryReason == nil || strings.TrimSpace(*raw.PrimaryReason) == "":
+		return Assessment{}, errors.New("missing primary_reason")
+	case raw.Message == nil || strings.TrimSpace(*raw.Message) == "":
+		return Assessment{}, errors.New("missing message")
+	case raw.Confidence == nil:
+		return Assessment{}, errors.New("missing confidence")
+	case raw.Action == nil:
+		return Assessment{}, errors.New("missing action")
+	}
+
+	if *raw.Confidence < 0 || *raw.Confidence > 1 {
+		return Assessment{}, fmt.Errorf("confidence %v is outside of 0 to 1", *raw.Confidence)
+	}
+
+	switch *raw.Action {
+	case ActionBlock, ActionVerify, ActionIgnore:
+	default:
+		return Assessment{}, fmt.Errorf("unsupported action: %q", *raw.Action)
+	}
+
+	return Assessment{
+		PrimaryReason: *raw.PrimaryReason,
+		Message:       *raw.Message,
+		Confidence:    *raw.Confidence,
+		Action:        *raw.Action,
+	}, nil
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAssessment(t *testing.T) {
+	cases := []struct {
+		name    string
+		resp    string
+		exp     Assessment
+		wantErr string
+	}{
+		{
+			name: "valid",
+			resp: `{"primary_reason": "far from home", "message": "Was this you?", "confidence": 0.8, "action": "verify"}`,
+			exp:  Assessment{PrimaryReason: "far from home", Message: "Was this you?", Confidence: 0.8, Action: ActionVerify},
+		},
+		{
+			name:    "prose",
+			resp:    `Your purchase was flagged because it was far from home.`,
+			wantErr: "decoding assessment: invalid character 'Y' looking for beginning of value",
+		},
+		{
+			name:    "missing field",
+			resp:    `{"primary_reason": "far from home", "confidence": 0.8, "action": "verify"}`,
+			wantErr: "missing message",
+		},
+		{
+			name:    "unknown field",
+			resp:    `{"primary_reason": "far from home", "message": "Was this you?", "confidence": 0.8, "action": "verify", "risk": "high"}`,
+			wantErr: `decoding assessment: json: unknown field "risk"`,
+		},
+		{
+			name:    "confidence out of range",
+			resp:    `{"primary_reason": "far from home", "message": "Was this you?", "confidence": 80, "action": "verify"}`,
+			wantErr: "confidence 80 is outside of 0 to 1",
+		},
+		{
+			name:    "unsupported action",
+			resp:    `{"primary_reason": "far from home", "message": "Was this you?", "confidence": 0.8, "action": "refund"}`,
+			wantErr: `unsupported action: "refund"`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			act, err := ParseAssessment(c.resp)
+			if c.wantErr != "" {
+				assert.EqualError(t, err, c.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.exp, act)
+		})
+	}
+}
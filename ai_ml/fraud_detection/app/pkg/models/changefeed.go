@@ -0,0 +1,279 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Envelope is the changefeed envelope option that determines the shape of
+// each message.
+type Envelope string
+
+const (
+	EnvelopeWrapped Envelope = "wrapped"
+	EnvelopeBare    Envelope = "bare"
+	EnvelopeKeyOnly Envelope = "key_only"
+	EnvelopeRow     Envelope = "row"
+)
+
+// Operation is the kind of change a message describes.
+type Operation string
+
+const (
+	// OperationInsert and OperationUpdate can only be told apart when the
+	// changefeed has the diff option, otherwise both are OperationUpsert.
+	OperationInsert Operation = "insert"
+	OperationUpdate Operation = "update"
+	OperationUpsert Operation = "upsert"
+	OperationDelete Operation = "delete"
+
+	// OperationResolved messages carry a resolved timestamp and no row.
+	OperationResolved Operation = "resolved"
+
+	// OperationUnknown is used for key_only messages, which don't say what
+	// happened to the row.
+	OperationUnknown Operation = "unknown"
+)
+
+// HLC is a CockroachDB hybrid-logical clock timestamp, as used for updated and
+// resolved timestamps, e.g. "1589399393853419000.0000000001".
+type HLC struct {
+	WallTime int64
+	Logical  int32
+}
+
+func ParseHLC(s string) (HLC, error) {
+	wall, logical, _ := strings.Cut(s, ".")
+
+	w, err := strconv.ParseInt(wall, 10, 64)
+	if err != nil {
+		return HLC{}, fmt.Errorf("parsing wall time %q: %w", wall, err)
+	}
+
+	var l int64
+	if logical != "" {
+		if l, err = strconv.ParseInt(logical, 10, 32); err != nil {
+			return HLC{}, fmt.Errorf("parsing logical time %q: %w", logical, err)
+		}
+	}
+
+	return HLC{WallTime: w, Logical: int32(l)}, nil
+}
+
+func (h HLC) IsZero() bool {
+	return h.WallTime == 0 && h.Logical == 0
+}
+
+func (h HLC) Time() time.Time {
+	return time.Unix(0, h.WallTime).UTC()
+}
+
+func (h HLC) Less(o HLC) bool {
+	return h.WallTime < o.WallTime || (h.WallTime == o.WallTime && h.Logical < o.Logical)
+}
+
+func (h HLC) String() string {
+	return fmt.Sprintf("%d.%010d", h.WallTime, h.Logical)
+}
+
+func (h *HLC) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	if s == "" {
+		*h = HLC{}
+		return nil
+	}
+
+	v, err := ParseHLC(s)
+	if err != nil {
+		return err
+	}
+
+	*h = v
+	return nil
+}
+
+type changefeedMetadata struct {
+	Updated  HLC `json:"updated"`
+	Resolved HLC `json:"resolved"`
+}
+
+type wrappedValue struct {
+	After    json.RawMessage `json:"after"`
+	Before   json.RawMessage `json:"before"`
+	Updated  HLC             `json:"updated"`
+	Resolved HLC             `json:"resolved"`
+}
+
+// DecodeChangefeed turns a changefeed message into a Message, according to
+// the envelope the changefeed was created with.
+func DecodeChangefeed(envelope Envelope, topic string, key, value []byte) (Message, error) {
+	k, err := decodeKey(key)
+	if err != nil {
+		return Message{}, fmt.Errorf("decoding key: %w", err)
+	}
+
+	m := Message{
+		Key:   k,
+		Topic: topic,
+		Raw:   value,
+	}
+
+	switch envelope {
+	case EnvelopeWrapped:
+		err = m.decodeWrapped(value)
+	case EnvelopeBare:
+		err = m.decodeBare(value)
+	case EnvelopeKeyOnly:
+		m.Operation = OperationUnknown
+	case EnvelopeRow, "":
+		err = m.decodeRow(value)
+	default:
+		return Message{}, fmt.Errorf("unsupported envelope: %q", envelope)
+	}
+
+	if err != nil {
+		return Message{}, fmt.Errorf("decoding %s value: %w", envelope, err)
+	}
+
+	return m, nil
+}
+
+// decodeKey converts a changefeed key, which is a JSON array of primary key
+// values, into strings.
+func decodeKey(key []byte) ([]string, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+
+	var parts []json.RawMessage
+	if err := json.Unmarshal(key, &parts); err != nil {
+		return nil, err
+	}
+
+	k := make([]string, len(parts))
+	for i, p := range parts {
+		var s string
+		if err := json.Unmarshal(p, &s); err != nil {
+			s = string(p)
+		}
+		k[i] = s
+	}
+
+	return k, nil
+}
+
+func isNull(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) == 0 || bytes.Equal(data, []byte("null"))
+}
+
+func (m *Message) decodeWrapped(value []byte) error {
+	if isNull(value) {
+		m.Operation = OperationDelete
+		return nil
+	}
+
+	var v wrappedValue
+	if err := json.Unmarshal(value, &v); err != nil {
+		return err
+	}
+
+	m.Updated = v.Updated
+	m.Resolved = v.Resolved
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(value, &fields); err != nil {
+		return err
+	}
+	_, hasAfter := fields["after"]
+	_, hasBefore := fields["before"]
+
+	switch {
+	case !v.Resolved.IsZero() && !hasAfter:
+		m.Operation = OperationResolved
+	case isNull(v.After):
+		m.Operation = OperationDelete
+	case !hasBefore:
+		m.Operation = OperationUpsert
+	case isNull(v.Before):
+		m.Operation = OperationInsert
+	default:
+		m.Operation = OperationUpdate
+	}
+
+	if !isNull(v.After) {
+		m.Payload = v.After
+	}
+	if !isNull(v.Before) {
+		m.Before = v.Before
+	}
+
+	return nil
+}
+
+func (m *Message) decodeBare(value []byte) error {
+	if isNull(value) {
+		m.Operation = OperationDelete
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(value, &fields); err != nil {
+		return err
+	}
+
+	if raw, ok := fields["__crdb__"]; ok {
+		var meta changefeedMetadata
+		if err := json.Unmarshal(raw, &meta); err != nil {
+			return fmt.Errorf("decoding metadata: %w", err)
+		}
+
+		m.Updated = meta.Updated
+		m.Resolved = meta.Resolved
+		delete(fields, "__crdb__")
+	}
+
+	if len(fields) == 0 && !m.Resolved.IsZero() {
+		m.Operation = OperationResolved
+		return nil
+	}
+
+	row, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	m.Operation = OperationUpsert
+	m.Payload = row
+	return nil
+}
+
+func (m *Message) decodeRow(value []byte) error {
+	if isNull(value) {
+		m.Operation = OperationDelete
+		return nil
+	}
+
+	// Resolved timestamps are emitted without a key, as a JSON object holding
+	// just the resolved field.
+	if m.Key == nil {
+		var meta changefeedMetadata
+		if err := json.Unmarshal(value, &meta); err == nil && !meta.Resolved.IsZero() {
+			m.Operation = OperationResolved
+			m.Resolved = meta.Resolved
+			return nil
+		}
+	}
+
+	m.Operation = OperationUpsert
+	m.Payload = value
+	return nil
+}
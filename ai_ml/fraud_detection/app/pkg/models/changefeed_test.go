@@ -0,0 +1,176 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHLC(t *testing.T) {
+	h, err := ParseHLC("1589399393853419000.0000000002")
+	assert.NoError(t, err)
+	assert.Equal(t, HLC{WallTime: 1589399393853419000, Logical: 2}, h)
+	assert.Equal(t, "1589399393853419000.0000000002", h.String())
+	assert.Equal(t, int64(1589399393853419000), h.Time().UnixNano())
+
+	_, err = ParseHLC("not-a-timestamp")
+	assert.Error(t, err)
+}
+
+func TestDecodeChangefeed(t *testing.T) {
+	const key = `["a9c3c5c4-8d4b-4d3e-9f7a-2b8c6c1f0e11", 42]`
+	updated := HLC{WallTime: 1700000000000000000, Logical: 1}
+	resolved := HLC{WallTime: 1700000001000000000}
+
+	cases := []struct {
+		name        string
+		envelope    Envelope
+		key         string
+		value       string
+		expKey      []string
+		expOp       Operation
+		expPayload  string
+		expBefore   string
+		expUpdated  HLC
+		expResolved HLC
+	}{
+		{
+			name:       "wrapped insert with diff",
+			envelope:   EnvelopeWrapped,
+			key:        key,
+			value:      `{"after": {"status": "pending"}, "before": null, "updated": "1700000000000000000.0000000001"}`,
+			expOp:      OperationInsert,
+			expPayload: `{"status": "pending"}`,
+			expUpdated: updated,
+		},
+		{
+			name:       "wrapped update with diff",
+			envelope:   EnvelopeWrapped,
+			key:        key,
+			value:      `{"after": {"status": "processed"}, "before": {"status": "pending"}, "updated": "1700000000000000000.0000000001"}`,
+			expOp:      OperationUpdate,
+			expPayload: `{"status": "processed"}`,
+			expBefore:  `{"status": "pending"}`,
+			expUpdated: updated,
+		},
+		{
+			name:       "wrapped without diff",
+			envelope:   EnvelopeWrapped,
+			key:        key,
+			value:      `{"after": {"status": "pending"}}`,
+			expOp:      OperationUpsert,
+			expPayload: `{"status": "pending"}`,
+		},
+		{
+			name:      "wrapped delete",
+			envelope:  EnvelopeWrapped,
+			key:       key,
+			value:     `{"after": null, "before": {"status": "pending"}}`,
+			expOp:     OperationDelete,
+			expBefore: `{"status": "pending"}`,
+		},
+		{
+			name:        "wrapped resolved",
+			envelope:    EnvelopeWrapped,
+			value:       `{"resolved": "1700000001000000000.0000000000"}`,
+			expOp:       OperationResolved,
+			expResolved: resolved,
+		},
+		{
+			name:       "bare",
+			envelope:   EnvelopeBare,
+			key:        key,
+			value:      `{"status": "pending", "__crdb__": {"updated": "1700000000000000000.0000000001"}}`,
+			expOp:      OperationUpsert,
+			expPayload: `{"status":"pending"}`,
+			expUpdated: updated,
+		},
+		{
+			name:        "bare resolved",
+			envelope:    EnvelopeBare,
+			value:       `{"__crdb__": {"resolved": "1700000001000000000.0000000000"}}`,
+			expOp:       OperationResolved,
+			expResolved: resolved,
+		},
+		{
+			name:     "key only",
+			envelope: EnvelopeKeyOnly,
+			key:      key,
+			expOp:    OperationUnknown,
+		},
+		{
+			name:       "row",
+			envelope:   EnvelopeRow,
+			key:        key,
+			value:      `{"status": "pending"}`,
+			expOp:      OperationUpsert,
+			expPayload: `{"status": "pending"}`,
+		},
+		{
+			name:     "row delete",
+			envelope: EnvelopeRow,
+			key:      key,
+			value:    `null`,
+			expOp:    OperationDelete,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m, err := DecodeChangefeed(c.envelope, "anomaly", []byte(c.key), []byte(c.value))
+			assert.NoError(t, err)
+
+			if c.key != "" {
+				assert.Equal(t, []string{"a9c3c5c4-8d4b-4d3e-9f7a-2b8c6c1f0e11", "42"}, m.Key)
+			} else {
+				assert.Nil(t, m.Key)
+			}
+
+			assert.Equal(t, "anomaly", m.Topic)
+			assert.Equal(t, c.expOp, m.Operation)
+			assert.Equal(t, c.expPayload, string(m.Payload))
+			assert.Equal(t, c.expBefore, string(m.Before))
+			assert.Equal(t, c.expUpdated, m.Updated)
+			assert.Equal(t, c.expResolved, m.Resolved)
+		})
+	}
+}
+
+func TestDecodeChangefeedErrors(t *testing.T) {
+	_, err := DecodeChangefeed(EnvelopeWrapped, "purchase", []byte(`not-json`), []byte(`{}`))
+	assert.Error(t, err)
+
+	_, err = DecodeChangefeed(EnvelopeWrapped, "purchase", []byte(`["a"]`), []byte(`{"after":`))
+	assert.Error(t, err)
+
+	_, err = DecodeChangefeed("json", "purchase", []byte(`["a"]`), []byte(`{}`))
+	assert.Error(t, err)
+}
+
+func TestParseBefore(t *testing.T) {
+	m := Message{
+		Payload: json.RawMessage(`{"status": "processed"}`),
+		Before:  json.RawMessage(`{"status": "pending"}`),
+	}
+
+	var after, before AnomalyMessage
+	assert.NoError(t, ParsePayload(m, &after))
+	assert.NoError(t, ParseBefore(m, &before))
+	assert.Equal(t, "processed", after.Status)
+	assert.Equal(t, "pending", before.Status)
+}
+
+func TestParsePurchaseLocation(t *testing.T) {
+	m := Message{Payload: json.RawMessage(`{"id": "p1", "location": {"type": "Point", "coordinates": [-0.1451, 51.5413]}}`)}
+
+	var p PurchaseMessage
+	assert.NoError(t, ParsePayload(m, &p))
+	assert.Equal(t, &LatLon{Lat: 51.5413, Lon: -0.1451}, p.Location)
+
+	m = Message{Payload: json.RawMessage(`{"id": "p1", "location": null}`)}
+
+	p = PurchaseMessage{}
+	assert.NoError(t, ParsePayload(m, &p))
+	assert.Nil(t, p.Location)
+}
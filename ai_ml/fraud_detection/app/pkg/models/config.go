@@ -1,12 +1,106 @@
 package models
 
+import "time"
+
 type Environment struct {
+	// AgentType is a single agent type, a comma-separated list of them, or
+	// "all". When running more than one agent, each uses its own default
+	// topic, group and dead-letter topic, so Topic, GroupID and
+	// DeadLetterTopic can only be set for a single agent.
 	AgentType      string `env:"AGENT_TYPE" required:"true"`
+	GroupID        string `env:"GROUP_ID"`
+	Topic          string `env:"TOPIC"`
 	DatabaseDriver string `env:"DATABASE_DRIVER" required:"true"`
 	DatabaseURL    string `env:"DATABASE_URL" required:"true"`
-	GroupID        string `env:"GROUP_ID" required:"true"`
 	Region         string `env:"REGION" required:"true"`
-	Topic          string `env:"TOPIC" required:"true"`
 	BusBroker      string `env:"BUS_BROKER" required:"true"`
-	OpenAIAPIKey   string `env:"OPENAI_API_KEY" required:"true"`
+
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" default:"30s"`
+	HTTPAddr        string        `env:"HTTP_ADDR" default:":9090"`
+
+	RetryMaxAttempts    int           `env:"RETRY_MAX_ATTEMPTS" default:"5"`
+	RetryInitialBackoff time.Duration `env:"RETRY_INITIAL_BACKOFF" default:"100ms"`
+	RetryMaxBackoff     time.Duration `env:"RETRY_MAX_BACKOFF" default:"10s"`
+
+	// RetryMaxDeferral is how long a message can wait out an unavailable
+	// dependency, such as an open LLM circuit breaker, before those waits
+	// count towards RetryMaxAttempts. Zero waits indefinitely.
+	RetryMaxDeferral time.Duration `env:"RETRY_MAX_DEFERRAL" default:"10m"`
+
+	// DeadLetterTopic defaults to the agent's, <agent>_dead_letter.
+	DeadLetterTopic string `env:"DEAD_LETTER_TOPIC"`
+
+	// AnomalyThreshold is the score above which purchases are anomalous. Zero
+	// uses the strategy's default.
+	AnomalyStrategy  string  `env:"ANOMALY_STRATEGY" default:"l2"`
+	AnomalyThreshold float64 `env:"ANOMALY_THRESHOLD"`
+
+	// Customers with fewer than AnomalyMinHistory previous purchases are
+	// compared against the fallback baseline, "cohort" or "population".
+	AnomalyMinHistory       int    `env:"ANOMALY_MIN_HISTORY" default:"5"`
+	AnomalyFallbackBaseline string `env:"ANOMALY_FALLBACK_BASELINE" default:"cohort"`
+
+	// AnomalyFalsePositiveWeight raises the threshold of customers whose
+	// anomalies are often purchases they made. Zero leaves it unchanged.
+	AnomalyFalsePositiveWeight float64 `env:"ANOMALY_FALSE_POSITIVE_WEIGHT"`
+
+	// RulesFile is a JSON file of rules to check purchases against, in place
+	// of the default rules.
+	RulesFile string `env:"RULES_FILE"`
+
+	LLMProvider  string `env:"LLM_PROVIDER" default:"openai"`
+	LLMModel     string `env:"LLM_MODEL" default:"gpt-4o"`
+	LLMBaseURL   string `env:"LLM_BASE_URL"`
+	OpenAIAPIKey string `env:"OPENAI_API_KEY"`
+
+	// LLMRateLimit is the number of LLM requests allowed per second across an
+	// agent's workers. Zero disables rate limiting.
+	LLMRateLimit       float64       `env:"LLM_RATE_LIMIT"`
+	LLMRateBurst       int           `env:"LLM_RATE_BURST" default:"1"`
+	LLMTimeout         time.Duration `env:"LLM_TIMEOUT" default:"30s"`
+	LLMBreakerFailures int           `env:"LLM_BREAKER_FAILURES" default:"5"`
+	LLMBreakerCooldown time.Duration `env:"LLM_BREAKER_COOLDOWN" default:"30s"`
+
+	// Anomalies whose contributions are the same when rounded to the nearest
+	// LLMCacheRounding percentage points share an assessment. A zero
+	// LLMCacheSize disables caching.
+	LLMCacheSize     int           `env:"LLM_CACHE_SIZE" default:"1000"`
+	LLMCacheTTL      time.Duration `env:"LLM_CACHE_TTL" default:"1h"`
+	LLMCacheRounding float64       `env:"LLM_CACHE_ROUNDING" default:"5"`
+
+	// ReviewRequired holds the reasoning agent's notifications until an
+	// analyst approves them in the review service.
+	ReviewRequired bool `env:"REVIEW_REQUIRED"`
+
+	// ReasoningAttempts is how many times the reasoning agent asks for an
+	// assessment before giving up on invalid responses.
+	ReasoningAttempts int `env:"REASONING_ATTEMPTS" default:"3"`
+
+	// PromptDir is a directory of <version>.tmpl prompt templates, in place
+	// of the built-in ones. PromptVariantPercent of anomalies use
+	// PromptVariant instead of PromptVersion.
+	PromptDir            string        `env:"PROMPT_DIR"`
+	PromptVersion        string        `env:"PROMPT_VERSION" default:"v1"`
+	PromptVariant        string        `env:"PROMPT_VARIANT"`
+	PromptVariantPercent int           `env:"PROMPT_VARIANT_PERCENT"`
+	PromptReloadInterval time.Duration `env:"PROMPT_RELOAD_INTERVAL"`
+	CompanyName          string        `env:"COMPANY_NAME" default:"ACME Corp."`
+
+	// PromptFallbackLocale is used for customers without a valid locale.
+	PromptFallbackLocale string `env:"PROMPT_FALLBACK_LOCALE" default:"en"`
+
+	NotifyEmail      string `env:"NOTIFY_EMAIL" default:"ses"`
+	NotifySMS        string `env:"NOTIFY_SMS" default:"sns"`
+	NotifyFrom       string `env:"NOTIFY_FROM"`
+	NotifyWebhookURL string `env:"NOTIFY_WEBHOOK_URL"`
+	NotifyFile       string `env:"NOTIFY_FILE" default:"notifications.jsonl"`
+	SMTPAddr         string `env:"SMTP_ADDR"`
+	SMTPUsername     string `env:"SMTP_USERNAME"`
+	SMTPPassword     string `env:"SMTP_PASSWORD"`
+
+	ConsumerWorkers int `env:"CONSUMER_WORKERS" default:"1"`
+
+	// Envelope is the changefeeds' envelope option. With key_only, agents
+	// look each row up by its key.
+	Envelope Envelope `env:"ENVELOPE" default:"wrapped"`
 }
@@ -6,17 +6,28 @@ import (
 	"time"
 )
 
+// Message is a single change from a changefeed. Payload holds the row as it
+// is after the change, and Before holds the row as it was before it (only
+// available with the diff changefeed option). Either may be empty, for
+// example for deletes and resolved timestamps. Raw holds the message value
+// exactly as it was received.
 type Message struct {
-	Key     []string        `json:"Key,omitempty"`
-	Topic   string          `json:"Topic,omitempty"`
-	Payload json.RawMessage `json:"Value"`
+	Key       []string          `json:"Key,omitempty"`
+	Topic     string            `json:"Topic,omitempty"`
+	Payload   json.RawMessage   `json:"Value"`
+	Before    json.RawMessage   `json:"Before,omitempty"`
+	Operation Operation         `json:"Operation,omitempty"`
+	Updated   HLC               `json:"-"`
+	Resolved  HLC               `json:"-"`
+	Headers   map[string]string `json:"Headers,omitempty"`
+	Raw       []byte            `json:"-"`
 }
 
 type PurchaseMessage struct {
 	ID         string       `json:"id"`
 	CustomerID string       `json:"customer_id"`
 	Amount     float64      `json:"amount"`
-	Location   LatLon       `json:"lat_lon"`
+	Location   *LatLon      `json:"location"`
 	Timestamp  time.Time    `json:"ts"`
 	Vector     VectorString `json:"vec"`
 }
@@ -26,6 +37,26 @@ type LatLon struct {
 	Lon float64 `json:"lon"`
 }
 
+// UnmarshalJSON decodes a GEOGRAPHY point, which changefeeds emit as GeoJSON
+// with coordinates in longitude, latitude order.
+func (l *LatLon) UnmarshalJSON(data []byte) error {
+	var point struct {
+		Type        string    `json:"type"`
+		Coordinates []float64 `json:"coordinates"`
+	}
+
+	if err := json.Unmarshal(data, &point); err != nil {
+		return err
+	}
+
+	if point.Type != "Point" || len(point.Coordinates) < 2 {
+		return fmt.Errorf("unsupported geography: %s", data)
+	}
+
+	l.Lon, l.Lat = point.Coordinates[0], point.Coordinates[1]
+	return nil
+}
+
 type NotificationMessage struct {
 	PurchaseID string    `json:"purchase_id"`
 	CustomerID string    `json:"customer_id"`
@@ -38,6 +69,8 @@ type AnomalyMessage struct {
 	PurchaseID string    `json:"purchase_id"`
 	CustomerID string    `json:"customer_id"`
 	Score      float64   `json:"score"`
+	Strategy   string    `json:"strategy"`
+	Baseline   string    `json:"baseline"`
 	Status     string    `json:"status"`
 	Timestamp  time.Time `json:"ts"`
 }
@@ -49,3 +82,12 @@ func ParsePayload(msg Message, val any) error {
 
 	return nil
 }
+
+// ParseBefore parses the row as it was before the change.
+func ParseBefore(msg Message, val any) error {
+	if err := json.Unmarshal(msg.Before, &val); err != nil {
+		return fmt.Errorf("unmarshalling message: %w", err)
+	}
+
+	return nil
+}
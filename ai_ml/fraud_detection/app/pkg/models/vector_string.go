@@ -14,6 +14,17 @@ func (v *VectorString) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
+	parsed, err := ParseVector(str)
+	if err != nil {
+		return err
+	}
+
+	*v = parsed
+	return nil
+}
+
+// ParseVector parses a vector as CockroachDB formats it, e.g. "[0.1,0.2,0.3]".
+func ParseVector(str string) (VectorString, error) {
 	str = strings.TrimPrefix(str, "[")
 	str = strings.TrimSuffix(str, "]")
 
@@ -27,11 +38,21 @@ func (v *VectorString) UnmarshalJSON(data []byte) error {
 		}
 		f, err := strconv.ParseFloat(part, 64)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		result = append(result, f)
 	}
 
-	*v = result
-	return nil
+	return result, nil
+}
+
+// String formats the vector as CockroachDB's VECTOR type expects it, e.g.
+// "[0.1,0.2,0.3]".
+func (v VectorString) String() string {
+	parts := make([]string, len(v))
+	for i, f := range v {
+		parts[i] = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	return "[" + strings.Join(parts, ",") + "]"
 }
@@ -0,0 +1,146 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// Sender names the Notifier a channel is routed to.
+type Sender string
+
+const (
+	SenderSES     Sender = "ses"
+	SenderSMTP    Sender = "smtp"
+	SenderSNS     Sender = "sns"
+	SenderWebhook Sender = "webhook"
+	SenderStdout  Sender = "stdout"
+	SenderFile    Sender = "file"
+)
+
+// webhookTimeout bounds each webhook request.
+const webhookTimeout = time.Second * 10
+
+// Config holds the settings for every sender; each uses the fields it needs.
+type Config struct {
+	Email  Sender
+	SMS    Sender
+	Region string
+	From   string
+
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+
+	WebhookURL string
+	FilePath   string
+}
+
+// NewRouter creates a Router that sends each channel with its configured
+// sender. Senders shared by both channels are only created once.
+func NewRouter(ctx context.Context, cfg Config) (Router, error) {
+	senders := map[Sender]Notifier{}
+	var awsConfig *aws.Config
+
+	sender := func(s Sender) (Notifier, error) {
+		if n, ok := senders[s]; ok {
+			return n, nil
+		}
+
+		if (s == SenderSES || s == SenderSNS) && awsConfig == nil {
+			c, err := config.LoadDefaultConfig(ctx, config.WithRegion(cfg.Region))
+			if err != nil {
+				return nil, fmt.Errorf("loading default config: %w", err)
+			}
+			awsConfig = &c
+		}
+
+		if (s == SenderSES || s == SenderSMTP) && cfg.From == "" {
+			return nil, fmt.Errorf("a from address is required for the %s sender", s)
+		}
+
+		var n Notifier
+		switch s {
+		case SenderSES:
+			n = NewSES(*awsConfig, cfg.From)
+		case SenderSMTP:
+			if err := validateSMTP(cfg.SMTPAddr); err != nil {
+				return nil, err
+			}
+
+			var err error
+			if n, err = NewSMTP(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.From); err != nil {
+				return nil, err
+			}
+		case SenderSNS:
+			n = NewSMS(NewSNS(*awsConfig))
+		case SenderWebhook:
+			if err := validateWebhook(cfg.WebhookURL); err != nil {
+				return nil, err
+			}
+			n = NewWebhook(cfg.WebhookURL, &http.Client{Timeout: webhookTimeout})
+		case SenderStdout:
+			n = NewWriter(os.Stdout)
+		case SenderFile:
+			// The file stays open for as long as the process runs.
+			f, err := os.OpenFile(cfg.FilePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+			if err != nil {
+				return nil, fmt.Errorf("opening notification file: %w", err)
+			}
+			n = NewWriter(f)
+		default:
+			return nil, fmt.Errorf("unsupported sender: %q", s)
+		}
+
+		senders[s] = n
+		return n, nil
+	}
+
+	r := Router{}
+	for channel, s := range map[Channel]Sender{ChannelEmail: cfg.Email, ChannelSMS: cfg.SMS} {
+		n, err := sender(s)
+		if err != nil {
+			return nil, fmt.Errorf("creating %s sender: %w", channel, err)
+		}
+		r[channel] = n
+	}
+
+	return r, nil
+}
+
+func validateSMTP(addr string) error {
+	if addr == "" {
+		return errors.New("an SMTP address is required for the smtp sender")
+	}
+
+	if host, port, err := net.SplitHostPort(addr); err != nil || host == "" || port == "" {
+		return fmt.Errorf("SMTP address must be a host and port: %q", addr)
+	}
+
+	return nil
+}
+
+func validateWebhook(rawURL string) error {
+	if rawURL == "" {
+		return errors.New("a URL is required for the webhook sender")
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("parsing webhook URL: %w", err)
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook URL must be an absolute http or https URL: %q", rawURL)
+	}
+
+	return nil
+}
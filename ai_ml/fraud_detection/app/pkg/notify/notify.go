@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Channel is the way a customer prefers to be contacted, as stored in the
+// customer table's preferred_contact column.
+type Channel string
+
+const (
+	ChannelEmail Channel = "email"
+	ChannelSMS   Channel = "sms"
+)
+
+// ErrUnsupportedChannel is returned for notifications that can't be routed,
+// which retrying won't fix.
+var ErrUnsupportedChannel = errors.New("unsupported channel")
+
+// Notification is a message for a customer, sent to the target address or
+// number for its channel. IdempotencyKey is the same for every attempt at
+// sending a notification, so that providers supporting one can discard
+// duplicates.
+type Notification struct {
+	Channel        Channel `json:"channel"`
+	Target         string  `json:"target"`
+	Subject        string  `json:"subject"`
+	Message        string  `json:"message"`
+	IdempotencyKey string  `json:"idempotency_key,omitempty"`
+}
+
+// Notifier delivers notifications, returning the ID its provider assigned to
+// the message. Webhooks pass the idempotency key on as an Idempotency-Key
+// header and SMTP uses it for the Message-ID, while SES and SNS have no way
+// to take one.
+type Notifier interface {
+	Send(ctx context.Context, n Notification) (string, error)
+}
+
+// Router sends each notification with the Notifier for its channel.
+type Router map[Channel]Notifier
+
+func (r Router) Send(ctx context.Context, n Notification) (string, error) {
+	notifier, ok := r[n.Channel]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedChannel, n.Channel)
+	}
+
+	return notifier.Send(ctx, n)
+}
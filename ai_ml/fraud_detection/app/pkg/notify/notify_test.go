@@ -0,0 +1,126 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSMS struct {
+	phone, message string
+}
+
+func (f *fakeSMS) SendSMS(ctx context.Context, phone, message string) (string, error) {
+	f.phone, f.message = phone, message
+	return "sms-1", nil
+}
+
+func TestRouter(t *testing.T) {
+	var email bytes.Buffer
+	sms := &fakeSMS{}
+
+	r := Router{
+		ChannelEmail: NewWriter(&email),
+		ChannelSMS:   NewSMS(sms),
+	}
+
+	id, err := r.Send(context.Background(), Notification{Channel: ChannelSMS, Target: "+441234567890", Message: "hi"})
+	assert.NoError(t, err)
+	assert.Equal(t, "sms-1", id)
+	assert.Equal(t, "+441234567890", sms.phone)
+	assert.Empty(t, email.String())
+
+	id, err = r.Send(context.Background(), Notification{Channel: ChannelEmail, Target: "a@b.com", Subject: "s", Message: "hi"})
+	assert.NoError(t, err)
+
+	var line map[string]string
+	assert.NoError(t, json.Unmarshal(email.Bytes(), &line))
+	assert.Equal(t, map[string]string{"id": id, "channel": "email", "target": "a@b.com", "subject": "s", "message": "hi"}, line)
+
+	_, err = r.Send(context.Background(), Notification{Channel: "pigeon"})
+	assert.ErrorIs(t, err, ErrUnsupportedChannel)
+}
+
+func TestWebhook(t *testing.T) {
+	var got Notification
+	var key string
+	status := http.StatusAccepted
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		key = r.Header.Get("Idempotency-Key")
+		w.Header().Set("X-Message-Id", "hook-1")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	w := NewWebhook(server.URL, server.Client())
+	n := Notification{Channel: ChannelEmail, Target: "a@b.com", Message: "hi", IdempotencyKey: "purchase-1"}
+
+	id, err := w.Send(context.Background(), n)
+	assert.NoError(t, err)
+	assert.Equal(t, "hook-1", id)
+	assert.Equal(t, n, got)
+	assert.Equal(t, "purchase-1", key)
+
+	status = http.StatusBadGateway
+	_, err = w.Send(context.Background(), n)
+	assert.Error(t, err)
+}
+
+func TestNewRouterValidation(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "smtp without address", cfg: Config{Email: SenderSMTP, SMS: SenderStdout, From: "fraud@example.com"}},
+		{name: "smtp without port", cfg: Config{Email: SenderSMTP, SMS: SenderStdout, From: "fraud@example.com", SMTPAddr: "localhost"}},
+		{name: "smtp with bad from", cfg: Config{Email: SenderSMTP, SMS: SenderStdout, From: "fraud", SMTPAddr: "localhost:25"}},
+		{name: "webhook without url", cfg: Config{Email: SenderWebhook, SMS: SenderStdout}},
+		{name: "webhook with relative url", cfg: Config{Email: SenderWebhook, SMS: SenderStdout, WebhookURL: "/notify"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := NewRouter(context.Background(), c.cfg)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := NewRouter(context.Background(), Config{Email: SenderSMTP, SMS: SenderWebhook, From: "fraud@example.com", SMTPAddr: "localhost:25", WebhookURL: "http://localhost/notify"})
+	assert.NoError(t, err)
+}
+
+func TestSMTPHeaderInjection(t *testing.T) {
+	s, err := NewSMTP("localhost:0", "", "", "fraud@example.com")
+	assert.NoError(t, err)
+
+	_, err = s.Send(context.Background(), Notification{Channel: ChannelEmail, Target: "a@b.com\r\nBcc: c@d.com", Subject: "s"})
+	assert.ErrorContains(t, err, "parsing target address")
+}
+
+func TestSMTPFromDisplayName(t *testing.T) {
+	s, err := NewSMTP("localhost:25", "", "", "Fraud Team <alerts@bank.com>")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	id, msg := s.message(&mail.Address{Address: "customer@example.com"}, Notification{Subject: "s"})
+	assert.True(t, strings.HasSuffix(id, "@bank.com>"), id)
+
+	// Repeated sends of a notification share a Message-ID.
+	id, _ = s.message(&mail.Address{Address: "customer@example.com"}, Notification{Subject: "s", IdempotencyKey: "purchase-1"})
+	assert.Equal(t, "<purchase-1@bank.com>", id)
+	assert.Contains(t, msg, "From: \"Fraud Team\" <alerts@bank.com>\r\n")
+	assert.Equal(t, "alerts@bank.com", s.from.Address)
+
+	_, err = NewSMTP("localhost:25", "", "", "Fraud Team")
+	assert.ErrorContains(t, err, "parsing from address")
+}
@@ -0,0 +1,43 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ses"
+	"github.com/aws/aws-sdk-go-v2/service/ses/types"
+)
+
+// SES sends email notifications with Amazon SES.
+type SES struct {
+	client *ses.Client
+	from   string
+}
+
+func NewSES(cfg aws.Config, from string) *SES {
+	return &SES{
+		client: ses.NewFromConfig(cfg),
+		from:   from,
+	}
+}
+
+func (s *SES) Send(ctx context.Context, n Notification) (string, error) {
+	out, err := s.client.SendEmail(ctx, &ses.SendEmailInput{
+		Source: aws.String(s.from),
+		Destination: &types.Destination{
+			ToAddresses: []string{n.Target},
+		},
+		Message: &types.Message{
+			Subject: &types.Content{Data: aws.String(n.Subject)},
+			Body: &types.Body{
+				Text: &types.Content{Data: aws.String(n.Message)},
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("sending email: %w", err)
+	}
+
+	return aws.ToString(out.MessageId), nil
+}
@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+)
+
+// SMSProvider sends a text message to a phone number in E.164 format,
+// returning the provider's message ID.
+type SMSProvider interface {
+	SendSMS(ctx context.Context, phone, message string) (string, error)
+}
+
+// SMS sends SMS notifications with an SMSProvider.
+type SMS struct {
+	provider SMSProvider
+}
+
+func NewSMS(p SMSProvider) *SMS {
+	return &SMS{provider: p}
+}
+
+func (s *SMS) Send(ctx context.Context, n Notification) (string, error) {
+	id, err := s.provider.SendSMS(ctx, n.Target, n.Message)
+	if err != nil {
+		return "", fmt.Errorf("sending sms: %w", err)
+	}
+
+	return id, nil
+}
+
+// SNS sends text messages with Amazon SNS.
+type SNS struct {
+	client *sns.Client
+}
+
+func NewSNS(cfg aws.Config) *SNS {
+	return &SNS{client: sns.NewFromConfig(cfg)}
+}
+
+func (s *SNS) SendSMS(ctx context.Context, phone, message string) (string, error) {
+	out, err := s.client.Publish(ctx, &sns.PublishInput{
+		PhoneNumber: aws.String(phone),
+		Message:     aws.String(message),
+	})
+	if err != nil {
+		return "", fmt.Errorf("publishing message: %w", err)
+	}
+
+	return aws.ToString(out.MessageId), nil
+}
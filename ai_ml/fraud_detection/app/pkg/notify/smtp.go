@@ -0,0 +1,82 @@
+package notify
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SMTP sends email notifications through an SMTP server, authenticating only
+// if a username is given.
+type SMTP struct {
+	addr string
+	auth smtp.Auth
+	from *mail.Address
+}
+
+// NewSMTP returns an error if from isn't an email address, which may have a
+// display name, such as "Fraud Team <alerts@example.com>".
+func NewSMTP(addr, username, password, from string) (*SMTP, error) {
+	f, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("parsing from address: %w", err)
+	}
+
+	s := SMTP{
+		addr: addr,
+		from: f,
+	}
+
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		s.auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &s, nil
+}
+
+// Send returns the Message-ID header it set, as SMTP servers don't return an
+// ID of their own. The Message-ID is derived from the idempotency key if there
+// is one, so mail clients can recognise repeated sends as the same message.
+// Targets are parsed as addresses and subjects encoded, so neither can add
+// headers of their own.
+func (s *SMTP) Send(ctx context.Context, n Notification) (string, error) {
+	to, err := mail.ParseAddress(n.Target)
+	if err != nil {
+		return "", fmt.Errorf("parsing target address: %w", err)
+	}
+
+	id, msg := s.message(to, n)
+
+	// net/smtp doesn't take a context, so the send can outlive a cancellation.
+	if err := smtp.SendMail(s.addr, s.auth, s.from.Address, []string{to.Address}, []byte(msg)); err != nil {
+		return "", fmt.Errorf("sending email: %w", err)
+	}
+
+	return id, nil
+}
+
+// message returns the email for a notification, and its Message-ID.
+func (s *SMTP) message(to *mail.Address, n Notification) (string, string) {
+	domain := s.from.Address[strings.LastIndex(s.from.Address, "@")+1:]
+	id := fmt.Sprintf("<%s@%s>", cmp.Or(n.IdempotencyKey, uuid.NewString()), domain)
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", n.Subject))
+	fmt.Fprintf(&msg, "Message-ID: %s\r\n", id)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(n.Message)
+
+	return id, msg.String()
+}
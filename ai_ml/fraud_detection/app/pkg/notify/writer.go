@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Writer writes notifications to a file or stdout as JSON lines, so the flow
+// can be exercised without sending anything.
+type Writer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (w *Writer) Send(ctx context.Context, n Notification) (string, error) {
+	line := struct {
+		ID string `json:"id"`
+		Notification
+	}{
+		ID:           uuid.NewString(),
+		Notification: n,
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := json.NewEncoder(w.w).Encode(line); err != nil {
+		return "", fmt.Errorf("writing notification: %w", err)
+	}
+
+	return line.ID, nil
+}
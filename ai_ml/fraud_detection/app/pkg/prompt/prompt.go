@@ -0,0 +1,252 @@
+package prompt
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"log"
+	"path"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+//go:embed templates/*.tmpl
+var defaults embed.FS
+
+// Default returns the prompt templates built into the agent.
+func Default() fs.FS {
+	sub, err := fs.Sub(defaults, "templates")
+	if err != nil {
+		panic(err)
+	}
+
+	return sub
+}
+
+// Data is what a template has to describe an anomaly.
+type Data struct {
+	PurchaseID            string
+	AmountContribution    float64
+	HourOfDayContribution float64
+	LocationContribution  float64
+	Rules                 []string
+
+	// Locale is the customer's locale, such as "fr" or "pt-BR". Unless it's
+	// valid, the fallback locale is used instead.
+	Locale string
+
+	// Language is the English name of the locale, and CompanyName comes from
+	// the Config. Both are set when rendering.
+	Language    string
+	CompanyName string
+}
+
+// Templates are prompt templates keyed by the name of their file without the
+// .tmpl extension. That's their version, optionally followed by a locale for
+// templates written for one language, e.g. v1.tmpl and v1.fr.tmpl.
+type Templates map[string]*template.Template
+
+// Load parses every .tmpl file at the root of fsys.
+func Load(fsys fs.FS) (Templates, error) {
+	files, err := fs.Glob(fsys, "*.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("listing templates: %w", err)
+	}
+
+	templates := Templates{}
+	for _, file := range files {
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", file, err)
+		}
+
+		version := strings.TrimSuffix(path.Base(file), ".tmpl")
+
+		t, err := template.New(version).Option("missingkey=error").Parse(string(b))
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", file, err)
+		}
+
+		templates[version] = t
+	}
+
+	return templates, nil
+}
+
+// Config selects the templates to render. VariantPercent of anomalies are
+// rendered with Variant rather than Version, to compare their wording.
+type Config struct {
+	Version        string
+	Variant        string
+	VariantPercent int
+	CompanyName    string
+
+	// FallbackLocale is used for customers without a valid locale. It
+	// defaults to "en".
+	FallbackLocale string
+
+	// ReloadInterval is how often to reload templates, so they can be changed
+	// without restarting. Zero disables reloading.
+	ReloadInterval time.Duration
+}
+
+func (c Config) validate(templates Templates) error {
+	if _, ok := templates[c.Version]; !ok {
+		return fmt.Errorf("missing template for version %q", c.Version)
+	}
+
+	if c.VariantPercent < 0 || c.VariantPercent > 100 {
+		return fmt.Errorf("variant percent %d is outside of 0 to 100", c.VariantPercent)
+	}
+
+	if c.VariantPercent > 0 {
+		if c.Variant == "" {
+			return errors.New("a variant is required for a variant percent")
+		}
+		if _, ok := templates[c.Variant]; !ok {
+			return fmt.Errorf("missing template for variant %q", c.Variant)
+		}
+	}
+
+	return nil
+}
+
+// Prompter renders prompts from a set of templates.
+type Prompter struct {
+	fsys      fs.FS
+	cfg       Config
+	fallback  language.Tag
+	templates atomic.Pointer[Templates]
+}
+
+func NewPrompter(fsys fs.FS, cfg Config) (*Prompter, error) {
+	fallback, err := language.Parse(cmp.Or(cfg.FallbackLocale, "en"))
+	if err != nil {
+		return nil, fmt.Errorf("parsing fallback locale: %w", err)
+	}
+
+	p := Prompter{
+		fsys:     fsys,
+		cfg:      cfg,
+		fallback: fallback,
+	}
+
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// Reload reads the templates again, keeping the current ones if the new ones
+// can't be loaded or are missing a configured version.
+func (p *Prompter) Reload() error {
+	templates, err := Load(p.fsys)
+	if err != nil {
+		return fmt.Errorf("loading templates: %w", err)
+	}
+
+	if err = p.cfg.validate(templates); err != nil {
+		return err
+	}
+
+	p.templates.Store(&templates)
+	return nil
+}
+
+// Watch reloads the templates every ReloadInterval until the context is
+// cancelled.
+func (p *Prompter) Watch(ctx context.Context) {
+	if p.cfg.ReloadInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(p.cfg.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Reload(); err != nil {
+				log.Printf("error reloading prompt templates: %v", err)
+			}
+		}
+	}
+}
+
+// Render returns the name of the template used for an anomaly and the prompt
+// rendered with it. The same key always gets the same version, so a retried
+// anomaly isn't moved between variants. The template for the customer's
+// locale is used if there is one, then the template for its language, and
+// then the version's default template.
+func (p *Prompter) Render(key string, data Data) (string, string, error) {
+	tag := p.locale(data.Locale)
+
+	data.Locale = tag.String()
+	data.Language = display.English.Languages().Name(tag)
+	data.CompanyName = p.cfg.CompanyName
+
+	name, t := p.template(p.choose(key), tag)
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", "", fmt.Errorf("executing template %q: %w", name, err)
+	}
+
+	return name, buf.String(), nil
+}
+
+// Locale returns the locale a prompt for the given customer locale is
+// rendered for, which is the fallback locale unless it's valid.
+func (p *Prompter) Locale(locale string) string {
+	return p.locale(locale).String()
+}
+
+func (p *Prompter) locale(locale string) language.Tag {
+	tag, err := language.Parse(locale)
+	if locale == "" || err != nil {
+		return p.fallback
+	}
+
+	return tag
+}
+
+func (p *Prompter) template(version string, tag language.Tag) (string, *template.Template) {
+	templates := *p.templates.Load()
+
+	base, _ := tag.Base()
+	for _, name := range []string{version + "." + tag.String(), version + "." + base.String()} {
+		if t, ok := templates[name]; ok {
+			return name, t
+		}
+	}
+
+	return version, templates[version]
+}
+
+func (p *Prompter) choose(key string) string {
+	if p.cfg.VariantPercent == 0 {
+		return p.cfg.Version
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	if int(h.Sum32()%100) < p.cfg.VariantPercent {
+		return p.cfg.Variant
+	}
+
+	return p.cfg.Version
+}
@@ -0,0 +1,127 @@
+package prompt
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefault(t *testing.T) {
+	p, err := NewPrompter(Default(), Config{Version: "v1", CompanyName: "ACME Corp."})
+	assert.NoError(t, err)
+
+	version, prompt, err := p.Render("a", Data{
+		PurchaseID:         "a",
+		AmountContribution: 0.75,
+		Rules:              []string{"amount of 5000.00 is over the limit of 1000.00"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", version)
+	assert.Contains(t, prompt, "(id: a)")
+	assert.Contains(t, prompt, "Purchase amount contributed 0.7500 to the detection")
+	assert.Contains(t, prompt, "It also broke these rules:\n\n- amount of 5000.00 is over the limit of 1000.00\n")
+	assert.Contains(t, prompt, `Our company name is "ACME Corp."`)
+}
+
+func TestVariant(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.tmpl": {Data: []byte("a {{.PurchaseID}}")},
+		"b.tmpl": {Data: []byte("b {{.PurchaseID}}")},
+	}
+
+	p, err := NewPrompter(fsys, Config{Version: "a", Variant: "b", VariantPercent: 20})
+	assert.NoError(t, err)
+
+	versions := map[string]int{}
+	for i := range 1000 {
+		key := fmt.Sprint(i)
+
+		version, prompt, err := p.Render(key, Data{PurchaseID: key})
+		assert.NoError(t, err)
+		assert.Equal(t, version+" "+key, prompt)
+		versions[version]++
+
+		again, _, _ := p.Render(key, Data{PurchaseID: key})
+		assert.Equal(t, version, again)
+	}
+
+	assert.InDelta(t, 200, versions["b"], 50)
+	assert.Equal(t, 1000, versions["a"]+versions["b"])
+}
+
+func TestReload(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.tmpl": {Data: []byte("before")},
+	}
+
+	p, err := NewPrompter(fsys, Config{Version: "a"})
+	assert.NoError(t, err)
+
+	fsys["a.tmpl"] = &fstest.MapFile{Data: []byte("after")}
+	assert.NoError(t, p.Reload())
+
+	_, prompt, err := p.Render("key", Data{})
+	assert.NoError(t, err)
+	assert.Equal(t, "after", prompt)
+
+	// Templates missing a configured version are rejected.
+	delete(fsys, "a.tmpl")
+	assert.EqualError(t, p.Reload(), `missing template for version "a"`)
+
+	_, prompt, err = p.Render("key", Data{})
+	assert.NoError(t, err)
+	assert.Equal(t, "after", prompt)
+}
+
+func TestConfig(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.tmpl": {Data: []byte("a")},
+	}
+
+	_, err := NewPrompter(fsys, Config{Version: "b"})
+	assert.EqualError(t, err, `missing template for version "b"`)
+
+	_, err = NewPrompter(fsys, Config{Version: "a", VariantPercent: 10})
+	assert.EqualError(t, err, "a variant is required for a variant percent")
+
+	_, err = NewPrompter(fsys, Config{Version: "a", Variant: "b", VariantPercent: 10})
+	assert.EqualError(t, err, `missing template for variant "b"`)
+
+	_, err = NewPrompter(fsys, Config{Version: "a", Variant: "a", VariantPercent: 101})
+	assert.Error(t, err)
+}
+
+func TestLocale(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.tmpl":       {Data: []byte("default in {{.Language}} ({{.Locale}})")},
+		"a.fr.tmpl":    {Data: []byte("en français")},
+		"a.pt-BR.tmpl": {Data: []byte("em português brasileiro")},
+	}
+
+	p, err := NewPrompter(fsys, Config{Version: "a", FallbackLocale: "de"})
+	assert.NoError(t, err)
+
+	cases := []struct {
+		locale  string
+		expName string
+		exp     string
+	}{
+		{locale: "fr", expName: "a.fr", exp: "en français"},
+		{locale: "fr-CA", expName: "a.fr", exp: "en français"},
+		{locale: "pt-BR", expName: "a.pt-BR", exp: "em português brasileiro"},
+		{locale: "es", expName: "a", exp: "default in Spanish (es)"},
+		{locale: "", expName: "a", exp: "default in German (de)"},
+		{locale: "not a locale", expName: "a", exp: "default in German (de)"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.locale, func(t *testing.T) {
+			name, prompt, err := p.Render("key", Data{Locale: c.locale})
+			assert.NoError(t, err)
+			assert.Equal(t, c.expName, name)
+			assert.Equal(t, c.exp, prompt)
+		})
+	}
+}
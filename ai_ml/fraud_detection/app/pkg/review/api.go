@@ -0,0 +1,94 @@
+package review
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const defaultLimit = 50
+
+// Register adds the review API to a mux:
+//
+//	GET  /anomalies?limit=n  lists anomalies awaiting review
+//	POST /reviews            records a Decision
+func Register(mux *http.ServeMux, q Queue) {
+	mux.HandleFunc("GET /anomalies", func(w http.ResponseWriter, r *http.Request) {
+		limit := defaultLimit
+		if s := r.URL.Query().Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		items, err := q.Pending(r.Context(), limit)
+		if err != nil {
+			log.Printf("error fetching pending anomalies: %v", err)
+			http.Error(w, "error fetching pending anomalies", http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, items)
+	})
+
+	mux.HandleFunc("POST /reviews", func(w http.ResponseWriter, r *http.Request) {
+		var d Decision
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			http.Error(w, "invalid decision", http.StatusBadRequest)
+			return
+		}
+
+		if d.PurchaseID == "" || d.CustomerID == "" || d.Reviewer == "" {
+			http.Error(w, "purchase_id, customer_id and reviewer are required", http.StatusBadRequest)
+			return
+		}
+
+		if err := d.Outcome.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err := q.Decide(r.Context(), d)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrAlreadyReviewed), errors.Is(err, ErrNoMessage):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case err != nil:
+			log.Printf("error recording review: %v", err)
+			http.Error(w, "error recording review", http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("error writing response: %v", err)
+	}
+}
+
+// RequireToken rejects requests that don't carry the token as a bearer token in
+// their Authorization header.
+func RequireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "missing or invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,106 @@
+package review
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Client is a Queue served by the review API, authenticating with its token.
+type Client struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		client:  http.DefaultClient,
+	}
+}
+
+func (c *Client) Pending(ctx context.Context, limit int) ([]Item, error) {
+	url := fmt.Sprintf("%s/anomalies?limit=%d", c.baseURL, limit)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+
+	var items []Item
+	if err = json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+
+	return items, nil
+}
+
+func (c *Client) Decide(ctx context.Context, d Decision) error {
+	body, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("encoding decision: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/reviews", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusConflict:
+		return conflictError(resp)
+	default:
+		return responseError(resp)
+	}
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	return c.client.Do(req)
+}
+
+// conflictError maps a conflict back to the error the API returned it for.
+func conflictError(resp *http.Response) error {
+	b, _ := io.ReadAll(resp.Body)
+
+	switch strings.TrimSpace(string(b)) {
+	case ErrAlreadyReviewed.Error():
+		return ErrAlreadyReviewed
+	case ErrNoMessage.Error():
+		return ErrNoMessage
+	default:
+		return fmt.Errorf("unexpected conflict: %s", b)
+	}
+}
+
+func responseError(resp *http.Response) error {
+	b, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("unexpected response %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+}
@@ -0,0 +1,279 @@
+package review
+
+import (
+	"context"
+	"crdb/ai_ml/fraud_detection/app/pkg/feedback"
+	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"crdb/ai_ml/fraud_detection/app/pkg/vectorize"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrNotFound        = errors.New("anomaly not found")
+	ErrAlreadyReviewed = errors.New("anomaly already reviewed")
+	ErrNoMessage       = errors.New("anomaly has no message awaiting review")
+)
+
+// Outcome is an analyst's decision on an anomaly.
+type Outcome string
+
+const (
+	// OutcomeConfirmedFraud marks the purchase as fraudulent, and releases
+	// its message to the customer.
+	OutcomeConfirmedFraud Outcome = "confirmed_fraud"
+
+	// OutcomeDismissed marks the anomaly as a false alarm, so the customer
+	// isn't contacted.
+	OutcomeDismissed Outcome = "dismissed"
+
+	// OutcomeApproved releases the message to the customer without judging
+	// whether the purchase was fraudulent.
+	OutcomeApproved Outcome = "approved"
+)
+
+func (o Outcome) validate() error {
+	switch o {
+	case OutcomeConfirmedFraud, OutcomeDismissed, OutcomeApproved:
+		return nil
+	default:
+		return fmt.Errorf("unsupported outcome: %q", o)
+	}
+}
+
+// label returns the label an outcome gives an anomaly, if any. Approval says
+// nothing about whether the purchase was fraudulent.
+func (o Outcome) label() (feedback.Label, bool) {
+	switch o {
+	case OutcomeConfirmedFraud:
+		return feedback.LabelConfirmedFraud, true
+	case OutcomeDismissed:
+		return feedback.LabelFalsePositive, true
+	default:
+		return "", false
+	}
+}
+
+// Contribution is how much a dimension of a purchase's vector contributed to
+// its distance from the baseline, as a percentage.
+type Contribution struct {
+	Dimension string  `json:"dimension"`
+	Percent   float64 `json:"percent"`
+}
+
+// Message is the notification generated for an anomaly.
+type Message struct {
+	Text          string  `json:"text"`
+	PrimaryReason string  `json:"primary_reason"`
+	Confidence    float64 `json:"confidence"`
+	Action        string  `json:"action"`
+	Status        string  `json:"status"`
+}
+
+// Item is an anomaly awaiting review. Message is nil until the reasoning
+// agent has generated one.
+type Item struct {
+	PurchaseID string         `json:"purchase_id"`
+	CustomerID string         `json:"customer_id"`
+	Amount     float64        `json:"amount"`
+	Timestamp  time.Time      `json:"ts"`
+	Score      float64        `json:"score"`
+	Strategy   string         `json:"strategy"`
+	Baseline   string         `json:"baseline"`
+	Breakdown  []Contribution `json:"breakdown"`
+	Message    *Message       `json:"message,omitempty"`
+}
+
+// Decision is an analyst's review of an anomaly.
+type Decision struct {
+	PurchaseID string  `json:"purchase_id"`
+	CustomerID string  `json:"customer_id"`
+	Outcome    Outcome `json:"outcome"`
+	Reviewer   string  `json:"reviewer"`
+}
+
+// Queue holds the anomalies awaiting review.
+type Queue interface {
+	Pending(ctx context.Context, limit int) ([]Item, error)
+	Decide(ctx context.Context, d Decision) error
+}
+
+// Store is a Queue of the anomalies in the database.
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+// Pending returns the oldest anomalies that haven't been reviewed. Each one's
+// breakdown is against the baseline it was detected with, as it was when the
+// purchase was made.
+func (s *Store) Pending(ctx context.Context, limit int) ([]Item, error) {
+	const stmt = `SELECT
+			a.purchase_id, a.customer_id, p.amount, p.ts, a.score,
+			COALESCE(a.strategy, ''), COALESCE(a.baseline, 'customer'),
+			p.vec::STRING, baseline_average(a.customer_id, COALESCE(a.baseline, 'customer'), p.ts)::STRING,
+			n.reasoning, n.primary_reason, n.confidence, n.action, n.status
+		FROM anomaly a
+		JOIN purchase p ON p.id = a.purchase_id
+		LEFT JOIN notification n ON n.purchase_id = a.purchase_id AND n.customer_id = a.customer_id
+		WHERE a.review IS NULL
+		ORDER BY a.ts
+		LIMIT $1`
+
+	rows, err := s.db.QueryContext(ctx, stmt, limit)
+	if err != nil {
+		return nil, fmt.Errorf("making query: %w", err)
+	}
+	defer rows.Close()
+
+	var items []Item
+	for rows.Next() {
+		var i Item
+		var vec, average, text, reason, action, status sql.NullString
+		var confidence sql.NullFloat64
+
+		err = rows.Scan(
+			&i.PurchaseID, &i.CustomerID, &i.Amount, &i.Timestamp, &i.Score,
+			&i.Strategy, &i.Baseline,
+			&vec, &average,
+			&text, &reason, &confidence, &action, &status,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+
+		if i.Breakdown, err = breakdown(vec, average); err != nil {
+			return nil, fmt.Errorf("computing breakdown of purchase %s: %w", i.PurchaseID, err)
+		}
+
+		if text.Valid {
+			i.Message = &Message{
+				Text:          text.String,
+				PrimaryReason: reason.String,
+				Confidence:    confidence.Float64,
+				Action:        action.String,
+				Status:        status.String,
+			}
+		}
+
+		items = append(items, i)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating rows: %w", err)
+	}
+
+	return items, nil
+}
+
+// breakdown returns how much each dimension of a purchase's vector
+// contributed to its distance from its baseline's average. There's nothing to
+// break down against an empty baseline.
+func breakdown(vec, average sql.NullString) ([]Contribution, error) {
+	if !vec.Valid || !average.Valid {
+		return nil, nil
+	}
+
+	v, err := models.ParseVector(vec.String)
+	if err != nil {
+		return nil, fmt.Errorf("parsing purchase vector: %w", err)
+	}
+
+	avg, err := models.ParseVector(average.String)
+	if err != nil {
+		return nil, fmt.Errorf("parsing baseline average: %w", err)
+	}
+
+	if len(v) != vectorize.Size() || len(avg) != vectorize.Size() {
+		return nil, fmt.Errorf("vectors have %d and %d elements rather than %d", len(v), len(avg), vectorize.Size())
+	}
+
+	var contributions []Contribution
+	for _, c := range vectorize.Breakdown(v, avg) {
+		contributions = append(contributions, Contribution{Dimension: c.Dimension, Percent: c.Percent})
+	}
+
+	return contributions, nil
+}
+
+// Decide records a review, labelling the anomaly and releasing or dismissing
+// its message if it's awaiting review. Messages generated after an anomaly's
+// been reviewed are released or dismissed by the reasoning agent.
+func (s *Store) Decide(ctx context.Context, d Decision) error {
+	if err := d.Outcome.validate(); err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	const lockStmt = `SELECT review FROM anomaly WHERE purchase_id = $1 AND customer_id = $2 FOR UPDATE`
+
+	var review sql.NullString
+	err = tx.QueryRowContext(ctx, lockStmt, d.PurchaseID, d.CustomerID).Scan(&review)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("locking anomaly: %w", err)
+	}
+	if review.Valid {
+		return ErrAlreadyReviewed
+	}
+
+	status := "pending"
+	if d.Outcome == OutcomeDismissed {
+		status = "dismissed"
+	}
+
+	const releaseStmt = `UPDATE notification SET status = $3
+		WHERE purchase_id = $1 AND customer_id = $2 AND status = 'review'`
+
+	res, err := tx.ExecContext(ctx, releaseStmt, d.PurchaseID, d.CustomerID, status)
+	if err != nil {
+		return fmt.Errorf("updating notification: %w", err)
+	}
+
+	// Approval is of the message, so there has to be one.
+	if d.Outcome == OutcomeApproved {
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("checking notification: %w", err)
+		}
+		if n == 0 {
+			return ErrNoMessage
+		}
+	}
+
+	const reviewStmt = `UPDATE anomaly SET review = $3, reviewed_by = $4, reviewed_at = now()
+		WHERE purchase_id = $1 AND customer_id = $2`
+
+	if _, err = tx.ExecContext(ctx, reviewStmt, d.PurchaseID, d.CustomerID, string(d.Outcome), d.Reviewer); err != nil {
+		return fmt.Errorf("updating anomaly: %w", err)
+	}
+
+	// Customers know best, so an analyst's label doesn't replace theirs.
+	if label, ok := d.Outcome.label(); ok {
+		const labelStmt = `UPDATE anomaly SET label = $3, label_source = $4, labelled_at = now()
+			WHERE purchase_id = $1 AND customer_id = $2 AND label IS NULL`
+
+		if _, err = tx.ExecContext(ctx, labelStmt, d.PurchaseID, d.CustomerID, string(label), string(feedback.SourceAnalyst)); err != nil {
+			return fmt.Errorf("labelling anomaly: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package review
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryQueue struct {
+	items     []Item
+	decisions []Decision
+}
+
+func (q *memoryQueue) Pending(ctx context.Context, limit int) ([]Item, error) {
+	return q.items[:min(limit, len(q.items))], nil
+}
+
+func (q *memoryQueue) Decide(ctx context.Context, d Decision) error {
+	for _, prev := range q.decisions {
+		if prev.PurchaseID == d.PurchaseID {
+			return ErrAlreadyReviewed
+		}
+	}
+
+	for _, i := range q.items {
+		if i.PurchaseID != d.PurchaseID {
+			continue
+		}
+		if d.Outcome == OutcomeApproved && i.Message == nil {
+			return ErrNoMessage
+		}
+
+		q.decisions = append(q.decisions, d)
+		return nil
+	}
+
+	return ErrNotFound
+}
+
+func TestClient(t *testing.T) {
+	q := &memoryQueue{
+		items: []Item{
+			{
+				PurchaseID: "p1",
+				CustomerID: "c1",
+				Amount:     10000,
+				Breakdown:  []Contribution{{Dimension: "amount", Percent: 98.5}},
+				Message:    &Message{Text: "Was this you?", Action: "verify", Status: "review"},
+			},
+			{PurchaseID: "p2", CustomerID: "c1"},
+		},
+	}
+
+	mux := http.NewServeMux()
+	Register(mux, q)
+
+	server := httptest.NewServer(RequireToken("secret", mux))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	_, err := NewClient(server.URL, "guess").Pending(ctx, 10)
+	assert.EqualError(t, err, "unexpected response 401: missing or invalid token")
+
+	c := NewClient(server.URL, "secret")
+
+	items, err := c.Pending(ctx, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, q.items, items)
+
+	items, err = c.Pending(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+
+	approve := Decision{PurchaseID: "p1", CustomerID: "c1", Outcome: OutcomeApproved, Reviewer: "analyst"}
+	assert.NoError(t, c.Decide(ctx, approve))
+	assert.ErrorIs(t, c.Decide(ctx, approve), ErrAlreadyReviewed)
+
+	assert.ErrorIs(t, c.Decide(ctx, Decision{PurchaseID: "p2", CustomerID: "c1", Outcome: OutcomeApproved, Reviewer: "analyst"}), ErrNoMessage)
+	assert.ErrorIs(t, c.Decide(ctx, Decision{PurchaseID: "p3", CustomerID: "c1", Outcome: OutcomeDismissed, Reviewer: "analyst"}), ErrNotFound)
+	assert.EqualError(t, c.Decide(ctx, Decision{PurchaseID: "p2", CustomerID: "c1", Outcome: "refund", Reviewer: "analyst"}), `unexpected response 400: unsupported outcome: "refund"`)
+
+	assert.Equal(t, []Decision{approve}, q.decisions)
+}
+
+func TestBreakdown(t *testing.T) {
+	vec := sql.NullString{String: "[1,0,0,0,0]", Valid: true}
+	average := sql.NullString{String: "[0,0,0,0,0]", Valid: true}
+
+	b, err := breakdown(vec, average)
+	assert.NoError(t, err)
+	assert.Equal(t, []Contribution{
+		{Dimension: "amount", Percent: 100},
+		{Dimension: "hour_of_day", Percent: 0},
+		{Dimension: "location", Percent: 0},
+	}, b)
+
+	b, err = breakdown(vec, sql.NullString{})
+	assert.NoError(t, err)
+	assert.Nil(t, b)
+
+	_, err = breakdown(vec, sql.NullString{String: "[0,0]", Valid: true})
+	assert.Error(t, err)
+}
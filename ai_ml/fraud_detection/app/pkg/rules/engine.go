@@ -0,0 +1,128 @@
+package rules
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Queryer is satisfied by both *sql.DB and *sql.Tx.
+type Queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Engine checks purchases against a set of rules, fetching the history they
+// need from the database.
+type Engine struct {
+	rules   []Rule
+	windows []time.Duration
+}
+
+func NewEngine(rules []Rule) (*Engine, error) {
+	e := Engine{rules: rules}
+	names := map[string]bool{}
+
+	for _, r := range rules {
+		if r.Name == "" {
+			return nil, errors.New("rules need a name")
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("duplicate rule: %q", r.Name)
+		}
+		names[r.Name] = true
+
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+
+		if w := time.Duration(r.Window); r.Type == TypeVelocity && !slices.Contains(e.windows, w) {
+			e.windows = append(e.windows, w)
+		}
+	}
+
+	return &e, nil
+}
+
+// Check returns the rules that a purchase breaks.
+func (e *Engine) Check(ctx context.Context, q Queryer, purchaseID, customerID string) ([]Triggered, error) {
+	if len(e.rules) == 0 {
+		return nil, nil
+	}
+
+	p, h, err := e.fetch(ctx, q, purchaseID, customerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The purchase has since been deleted.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return evaluate(e.rules, p, h), nil
+}
+
+func (e *Engine) fetch(ctx context.Context, q Queryer, purchaseID, customerID string) (Purchase, History, error) {
+	const purchaseStmt = `SELECT p.amount, p.ts, ST_Y(p.location::GEOMETRY), ST_X(p.location::GEOMETRY), c.amount_cap
+		FROM purchase p
+		JOIN customer c ON c.id = p.customer_id
+		WHERE p.id = $1`
+
+	const previousStmt = `SELECT amount, ts, ST_Y(location::GEOMETRY), ST_X(location::GEOMETRY)
+		FROM purchase
+		WHERE customer_id = $1
+		AND id != $2
+		AND ts <= $3
+		ORDER BY ts DESC
+		LIMIT 1`
+
+	const recentStmt = `SELECT count(*)
+		FROM purchase
+		WHERE customer_id = $1
+		AND ts > $2::TIMESTAMPTZ - $3 * INTERVAL '1 second'
+		AND ts <= $2`
+
+	var h History
+	var amountCap sql.NullFloat64
+
+	row := q.QueryRowContext(ctx, purchaseStmt, purchaseID)
+	p, err := scanPurchase(row, &amountCap)
+	if err != nil {
+		return Purchase{}, History{}, err
+	}
+	h.AmountCap = amountCap.Float64
+
+	row = q.QueryRowContext(ctx, previousStmt, customerID, purchaseID, p.Timestamp)
+	prev, err := scanPurchase(row)
+	switch {
+	case err == nil:
+		h.Previous = &prev
+	case !errors.Is(err, sql.ErrNoRows):
+		return Purchase{}, History{}, fmt.Errorf("fetching previous purchase: %w", err)
+	}
+
+	h.Recent = map[time.Duration]int{}
+	for _, w := range e.windows {
+		var n int
+		if err = q.QueryRowContext(ctx, recentStmt, customerID, p.Timestamp, w.Seconds()).Scan(&n); err != nil {
+			return Purchase{}, History{}, fmt.Errorf("counting recent purchases: %w", err)
+		}
+		h.Recent[w] = n
+	}
+
+	return p, h, nil
+}
+
+func scanPurchase(row *sql.Row, extra ...any) (Purchase, error) {
+	var p Purchase
+	var lat, lon sql.NullFloat64
+
+	if err := row.Scan(append([]any{&p.Amount, &p.Timestamp, &lat, &lon}, extra...)...); err != nil {
+		return Purchase{}, err
+	}
+
+	p.Lat, p.Lon, p.Located = lat.Float64, lon.Float64, lat.Valid && lon.Valid
+	return p, nil
+}
@@ -0,0 +1,200 @@
+package rules
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"time"
+)
+
+//go:embed default_rules.json
+var defaultRules []byte
+
+// Type is the kind of check a rule performs.
+type Type string
+
+const (
+	// TypeVelocity limits how many purchases a customer can make in a window.
+	TypeVelocity Type = "velocity"
+
+	// TypeGeoVelocity limits how fast a customer would have to travel between
+	// consecutive purchases.
+	TypeGeoVelocity Type = "geo_velocity"
+
+	// TypeAmountCap limits the amount of a single purchase. A customer's
+	// amount_cap column overrides the rule's limit.
+	TypeAmountCap Type = "amount_cap"
+)
+
+// Rule is a declarative check on a purchase. Each type uses its own fields.
+type Rule struct {
+	Name string `json:"name"`
+	Type Type   `json:"type"`
+
+	MaxPurchases int      `json:"max_purchases,omitempty"`
+	Window       Duration `json:"window,omitempty"`
+
+	MaxKPH float64 `json:"max_kph,omitempty"`
+
+	MaxAmount float64 `json:"max_amount,omitempty"`
+}
+
+func (r Rule) validate() error {
+	switch r.Type {
+	case TypeVelocity:
+		if r.MaxPurchases <= 0 || r.Window <= 0 {
+			return fmt.Errorf("%s rules need max_purchases and window", r.Type)
+		}
+	case TypeGeoVelocity:
+		if r.MaxKPH <= 0 {
+			return fmt.Errorf("%s rules need max_kph", r.Type)
+		}
+	case TypeAmountCap:
+		if r.MaxAmount <= 0 {
+			return fmt.Errorf("%s rules need max_amount", r.Type)
+		}
+	default:
+		return fmt.Errorf("unsupported rule type: %q", r.Type)
+	}
+
+	return nil
+}
+
+// Duration is a time.Duration written as a string, e.g. "1m".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Load reads rules from a JSON file, or returns the default rules if path is
+// empty.
+func Load(path string) ([]Rule, error) {
+	data := defaultRules
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("reading rules: %w", err)
+		}
+	}
+
+	var rules []Rule
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("parsing rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// Triggered is a rule that a purchase broke.
+type Triggered struct {
+	Rule   string
+	Type   Type
+	Detail string
+}
+
+// Purchase is what the rules need to know about a purchase.
+type Purchase struct {
+	Amount    float64
+	Timestamp time.Time
+	Lat, Lon  float64
+	Located   bool
+}
+
+// History is what the rules need to know about the customer's other
+// purchases.
+type History struct {
+	// Previous is the customer's purchase before this one, if any.
+	Previous *Purchase
+
+	// Recent is the number of purchases the customer made in each velocity
+	// rule's window up to and including this one.
+	Recent map[time.Duration]int
+
+	// AmountCap is the customer's own amount cap, if set.
+	AmountCap float64
+}
+
+// evaluate returns the rules a purchase breaks.
+func evaluate(rules []Rule, p Purchase, h History) []Triggered {
+	var triggered []Triggered
+
+	for _, r := range rules {
+		var detail string
+
+		switch r.Type {
+		case TypeVelocity:
+			window := time.Duration(r.Window)
+			if n := h.Recent[window]; n > r.MaxPurchases {
+				detail = fmt.Sprintf("%d purchases in %s, more than the limit of %d", n, window, r.MaxPurchases)
+			}
+
+		case TypeGeoVelocity:
+			prev := h.Previous
+			if prev == nil || !prev.Located || !p.Located {
+				continue
+			}
+
+			km := distanceKM(prev.Lat, prev.Lon, p.Lat, p.Lon)
+			hours := p.Timestamp.Sub(prev.Timestamp).Hours()
+
+			// Purchases at the same moment in different places are as
+			// impossible as it gets.
+			if km > 1 && (hours <= 0 || km/hours > r.MaxKPH) {
+				detail = fmt.Sprintf("%.0fkm from the previous purchase, %s earlier", km, p.Timestamp.Sub(prev.Timestamp).Round(time.Second))
+			}
+
+		case TypeAmountCap:
+			limit := r.MaxAmount
+			if h.AmountCap > 0 {
+				limit = h.AmountCap
+			}
+
+			if p.Amount > limit {
+				detail = fmt.Sprintf("amount of %.2f is over the limit of %.2f", p.Amount, limit)
+			}
+		}
+
+		if detail != "" {
+			triggered = append(triggered, Triggered{Rule: r.Name, Type: r.Type, Detail: detail})
+		}
+	}
+
+	return triggered
+}
+
+const earthRadiusKM = 6371
+
+// distanceKM is the great-circle distance between two points.
+func distanceKM(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := rad(lat2 - lat1)
+	dLon := rad(lon2 - lon1)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadiusKM * math.Asin(math.Sqrt(a))
+}
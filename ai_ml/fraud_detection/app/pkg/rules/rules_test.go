@@ -0,0 +1,96 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadDefaults(t *testing.T) {
+	rules, err := Load("")
+	assert.NoError(t, err)
+
+	e, err := NewEngine(rules)
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Duration{time.Minute}, e.windows)
+}
+
+func TestNewEngineValidates(t *testing.T) {
+	_, err := NewEngine([]Rule{{Name: "a", Type: TypeVelocity, MaxPurchases: 5}})
+	assert.Error(t, err)
+
+	_, err = NewEngine([]Rule{{Name: "a", Type: "weather"}})
+	assert.Error(t, err)
+
+	_, err = NewEngine([]Rule{
+		{Name: "a", Type: TypeAmountCap, MaxAmount: 10},
+		{Name: "a", Type: TypeAmountCap, MaxAmount: 20},
+	})
+	assert.Error(t, err)
+}
+
+func TestEvaluate(t *testing.T) {
+	rules := []Rule{
+		{Name: "burst", Type: TypeVelocity, MaxPurchases: 3, Window: Duration(time.Minute)},
+		{Name: "travel", Type: TypeGeoVelocity, MaxKPH: 900},
+		{Name: "cap", Type: TypeAmountCap, MaxAmount: 100},
+	}
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	london := Purchase{Amount: 10, Timestamp: now.Add(-time.Hour), Lat: 51.5074, Lon: -0.1278, Located: true}
+
+	cases := []struct {
+		name     string
+		purchase Purchase
+		history  History
+		exp      []string
+	}{
+		{
+			name:     "nothing unusual",
+			purchase: Purchase{Amount: 10, Timestamp: now, Lat: 51.52, Lon: -0.1, Located: true},
+			history:  History{Previous: &london, Recent: map[time.Duration]int{time.Minute: 1}},
+		},
+		{
+			name:     "burst of purchases",
+			purchase: Purchase{Amount: 10, Timestamp: now},
+			history:  History{Recent: map[time.Duration]int{time.Minute: 4}},
+			exp:      []string{"burst"},
+		},
+		{
+			name:     "london to new york in an hour",
+			purchase: Purchase{Amount: 10, Timestamp: now, Lat: 40.7128, Lon: -74.0060, Located: true},
+			history:  History{Previous: &london},
+			exp:      []string{"travel"},
+		},
+		{
+			name:     "unlocated purchase",
+			purchase: Purchase{Amount: 10, Timestamp: now},
+			history:  History{Previous: &london},
+		},
+		{
+			name:     "over the cap",
+			purchase: Purchase{Amount: 150, Timestamp: now},
+			exp:      []string{"cap"},
+		},
+		{
+			name:     "within customer's own cap",
+			purchase: Purchase{Amount: 150, Timestamp: now},
+			history:  History{AmountCap: 200},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got []string
+			for _, tr := range evaluate(rules, c.purchase, c.history) {
+				got = append(got, tr.Rule)
+			}
+			assert.Equal(t, c.exp, got)
+		})
+	}
+}
+
+func TestDistanceKM(t *testing.T) {
+	assert.InDelta(t, 5570, distanceKM(51.5074, -0.1278, 40.7128, -74.0060), 10)
+}
@@ -0,0 +1,241 @@
+package scoring
+
+import (
+	"cmp"
+	"context"
+	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Queryer is satisfied by both *sql.DB and *sql.Tx.
+type Queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Name identifies a Strategy.
+type Name string
+
+const (
+	NameL2               Name = "l2"
+	NameZScore           Name = "zscore"
+	NamePercentile       Name = "percentile"
+	NameNearestNeighbour Name = "nearest_neighbour"
+)
+
+// Baseline is the set of purchases a purchase is compared against.
+type Baseline string
+
+const (
+	// BaselineCustomer compares a purchase against the customer's own.
+	BaselineCustomer Baseline = "customer"
+
+	// BaselineCohort compares a purchase against those of customers in the
+	// same region.
+	BaselineCohort Baseline = "cohort"
+
+	// BaselinePopulation compares a purchase against everyone's.
+	BaselinePopulation Baseline = "population"
+)
+
+// Strategy scores a purchase against a baseline. The higher the score, the
+// more unusual the purchase.
+type Strategy interface {
+	Score(ctx context.Context, q Queryer, p models.PurchaseMessage, b Baseline) (float64, error)
+
+	// DefaultThreshold is the score above which a purchase is anomalous,
+	// unless a threshold is configured.
+	DefaultThreshold() float64
+}
+
+var strategies = map[Name]Strategy{
+	NameL2:               l2{},
+	NameZScore:           zScore{},
+	NamePercentile:       percentile{},
+	NameNearestNeighbour: nearestNeighbour{},
+}
+
+func Get(name Name) (Strategy, error) {
+	s, ok := strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported scoring strategy: %q", name)
+	}
+
+	return s, nil
+}
+
+// Result is the outcome of scoring a purchase.
+type Result struct {
+	Strategy  Name
+	Baseline  Baseline
+	Score     float64
+	Threshold float64
+}
+
+func (r Result) Anomalous() bool {
+	return r.Score > r.Threshold
+}
+
+// Scorer scores purchases with a default strategy and threshold, which a
+// customer can override with the anomaly_strategy and anomaly_threshold
+// columns of their customer row.
+//
+// Purchases are compared against the customer's own history once they have
+// at least minHistory earlier purchases, and against the fallback baseline
+// until then. Only purchases made before the one being scored count towards
+// either, so rescoring a purchase later gives much the same result.
+//
+// Once minLabelled of a customer's anomalies have been labelled, their
+// threshold is raised in proportion to how many turned out to be purchases
+// they made, by up to falsePositiveWeight of itself.
+type Scorer struct {
+	strategy            Name
+	threshold           float64
+	minHistory          int
+	fallback            Baseline
+	falsePositiveWeight float64
+}
+
+// minLabelled is how many of a customer's anomalies must be labelled before
+// their false positive rate affects their threshold.
+const minLabelled = 3
+
+// NewScorer returns a Scorer for the given strategy. A zero threshold uses
+// the strategy's default, and a zero falsePositiveWeight leaves thresholds
+// unaffected by labels.
+func NewScorer(strategy Name, threshold float64, minHistory int, fallback Baseline, falsePositiveWeight float64) (*Scorer, error) {
+	if _, err := Get(strategy); err != nil {
+		return nil, err
+	}
+
+	switch fallback {
+	case BaselineCohort, BaselinePopulation:
+	default:
+		return nil, fmt.Errorf("unsupported fallback baseline: %q", fallback)
+	}
+
+	if falsePositiveWeight < 0 {
+		return nil, fmt.Errorf("false positive weight can't be negative: %v", falsePositiveWeight)
+	}
+
+	return &Scorer{
+		strategy:            strategy,
+		threshold:           threshold,
+		minHistory:          minHistory,
+		fallback:            fallback,
+		falsePositiveWeight: falsePositiveWeight,
+	}, nil
+}
+
+func (s *Scorer) Score(ctx context.Context, q Queryer, p models.PurchaseMessage) (Result, error) {
+	c, err := fetchCustomer(ctx, q, p)
+	if err != nil {
+		return Result{}, fmt.Errorf("fetching customer: %w", err)
+	}
+
+	name, threshold := s.resolve(c.override)
+	baseline := s.baseline(c)
+
+	strategy, err := Get(name)
+	if err != nil {
+		return Result{}, err
+	}
+
+	score, err := strategy.Score(ctx, q, p, baseline)
+	if err != nil {
+		return Result{}, fmt.Errorf("scoring with %s against %s baseline: %w", name, baseline, err)
+	}
+
+	return Result{
+		Strategy:  name,
+		Baseline:  baseline,
+		Score:     score,
+		Threshold: s.adjust(cmp.Or(threshold, strategy.DefaultThreshold()), c),
+	}, nil
+}
+
+// adjust raises a threshold for customers whose anomalies are often false
+// positives.
+func (s *Scorer) adjust(threshold float64, c customer) float64 {
+	return threshold * (1 + s.falsePositiveWeight*c.falsePositiveRate)
+}
+
+// override is a customer's own strategy and threshold, either of which may
+// be unset.
+type override struct {
+	strategy  Name
+	threshold float64
+}
+
+// resolve picks the strategy and threshold for a customer. A customer's own
+// threshold applies whichever strategy they use, but the configured threshold
+// only applies to the configured strategy, as each strategy's scores are on a
+// different scale. A zero threshold means the strategy's default.
+func (s *Scorer) resolve(o override) (Name, float64) {
+	if o.strategy == "" || o.strategy == s.strategy {
+		return s.strategy, cmp.Or(o.threshold, s.threshold)
+	}
+
+	return o.strategy, o.threshold
+}
+
+// baseline picks what to compare a customer's purchase against. Customers
+// without a region can't be placed in a cohort, so fall back to everyone.
+func (s *Scorer) baseline(c customer) Baseline {
+	if c.history >= s.minHistory {
+		return BaselineCustomer
+	}
+
+	if s.fallback == BaselineCohort && c.region == "" {
+		return BaselinePopulation
+	}
+
+	return s.fallback
+}
+
+// customer is what a Scorer needs to know about the customer who made a
+// purchase.
+type customer struct {
+	override
+
+	region string
+
+	// history is the number of purchases the customer made before the one
+	// being scored.
+	history int
+
+	// falsePositiveRate is the fraction of the customer's labelled anomalies
+	// that were false positives, or zero until minLabelled are labelled.
+	falsePositiveRate float64
+}
+
+func fetchCustomer(ctx context.Context, q Queryer, p models.PurchaseMessage) (customer, error) {
+	const stmt = `SELECT
+			c.anomaly_strategy,
+			c.anomaly_threshold,
+			c.region,
+			(SELECT count(*) FROM purchase WHERE customer_id = c.id AND id != $2 AND ($4::TIMESTAMPTZ IS NULL OR ts < $4)),
+			(SELECT rate FROM customer_false_positive_rate WHERE customer_id = c.id AND labelled >= $3)
+		FROM customer c
+		WHERE c.id = $1`
+
+	var strategy, region sql.NullString
+	var threshold, falsePositiveRate sql.NullFloat64
+	var history int
+
+	err := q.QueryRowContext(ctx, stmt, p.CustomerID, p.ID, minLabelled, before(p)).Scan(&strategy, &threshold, &region, &history, &falsePositiveRate)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return customer{}, err
+	}
+
+	return customer{
+		override: override{
+			strategy:  Name(strategy.String),
+			threshold: threshold.Float64,
+		},
+		region:            region.String,
+		history:           history,
+		falsePositiveRate: falsePositiveRate.Float64,
+	}, nil
+}
@@ -0,0 +1,102 @@
+package scoring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewScorer(t *testing.T) {
+	_, err := NewScorer("cosine", 0, 5, BaselineCohort, 0)
+	assert.Error(t, err)
+
+	_, err = NewScorer(NameL2, 0, 5, BaselineCustomer, 0)
+	assert.Error(t, err)
+
+	for name := range strategies {
+		_, err := NewScorer(name, 0, 5, BaselinePopulation, 0)
+		assert.NoError(t, err)
+	}
+}
+
+func TestScorerResolve(t *testing.T) {
+	cases := []struct {
+		name         string
+		threshold    float64
+		override     override
+		expStrategy  Name
+		expThreshold float64
+	}{
+		{
+			name:        "defaults",
+			expStrategy: NameL2,
+		},
+		{
+			name:         "configured threshold",
+			threshold:    0.5,
+			expStrategy:  NameL2,
+			expThreshold: 0.5,
+		},
+		{
+			name:         "customer threshold",
+			threshold:    0.5,
+			override:     override{threshold: 0.8},
+			expStrategy:  NameL2,
+			expThreshold: 0.8,
+		},
+		{
+			name:        "customer strategy ignores configured threshold",
+			threshold:   0.5,
+			override:    override{strategy: NameZScore},
+			expStrategy: NameZScore,
+		},
+		{
+			name:         "customer strategy and threshold",
+			threshold:    0.5,
+			override:     override{strategy: NameZScore, threshold: 4},
+			expStrategy:  NameZScore,
+			expThreshold: 4,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, err := NewScorer(NameL2, c.threshold, 5, BaselineCohort, 0)
+			assert.NoError(t, err)
+
+			strategy, threshold := s.resolve(c.override)
+			assert.Equal(t, c.expStrategy, strategy)
+			assert.Equal(t, c.expThreshold, threshold)
+		})
+	}
+}
+
+func TestScorerBaseline(t *testing.T) {
+	cohort, err := NewScorer(NameL2, 0, 5, BaselineCohort, 0)
+	assert.NoError(t, err)
+
+	population, err := NewScorer(NameL2, 0, 5, BaselinePopulation, 0)
+	assert.NoError(t, err)
+
+	assert.Equal(t, BaselineCustomer, cohort.baseline(customer{history: 5, region: "uk"}))
+	assert.Equal(t, BaselineCohort, cohort.baseline(customer{history: 4, region: "uk"}))
+	assert.Equal(t, BaselinePopulation, cohort.baseline(customer{history: 0}))
+	assert.Equal(t, BaselinePopulation, population.baseline(customer{history: 4, region: "uk"}))
+}
+
+func TestResultAnomalous(t *testing.T) {
+	assert.False(t, Result{Score: 0.3, Threshold: 0.3}.Anomalous())
+	assert.True(t, Result{Score: 0.31, Threshold: 0.3}.Anomalous())
+}
+
+func TestScorerAdjust(t *testing.T) {
+	s, err := NewScorer(NameL2, 0, 5, BaselineCohort, 0.5)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 0.3, s.adjust(0.3, customer{}))
+	assert.InDelta(t, 0.45, s.adjust(0.3, customer{falsePositiveRate: 1}), 0.0001)
+	assert.InDelta(t, 0.375, s.adjust(0.3, customer{falsePositiveRate: 0.5}), 0.0001)
+
+	_, err = NewScorer(NameL2, 0, 5, BaselineCohort, -1)
+	assert.Error(t, err)
+}
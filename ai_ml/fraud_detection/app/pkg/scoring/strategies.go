@@ -0,0 +1,118 @@
+package scoring
+
+import (
+	"context"
+	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"database/sql"
+	"errors"
+)
+
+// l2 is the distance between a purchase and the average of the baseline's
+// purchases.
+type l2 struct{}
+
+func (l2) DefaultThreshold() float64 { return 0.3 }
+
+func (l2) Score(ctx context.Context, q Queryer, p models.PurchaseMessage, b Baseline) (float64, error) {
+	return scoreFunction(ctx, q, `SELECT purchase_distance_from_average($1, $2, $3, $4::TIMESTAMPTZ)`, p, b)
+}
+
+// zScore is the l2 distance in standard deviations of the distances of the
+// baseline's purchases, so it adapts to how consistent a customer is.
+type zScore struct{}
+
+func (zScore) DefaultThreshold() float64 { return 3 }
+
+func (zScore) Score(ctx context.Context, q Queryer, p models.PurchaseMessage, b Baseline) (float64, error) {
+	return scoreFunction(ctx, q, `SELECT purchase_distance_zscore($1, $2, $3, $4::TIMESTAMPTZ)`, p, b)
+}
+
+// percentile is the fraction of the baseline's purchases that are closer to
+// their average than this one.
+type percentile struct{}
+
+func (percentile) DefaultThreshold() float64 { return 0.99 }
+
+func (percentile) Score(ctx context.Context, q Queryer, p models.PurchaseMessage, b Baseline) (float64, error) {
+	return scoreFunction(ctx, q, `SELECT purchase_distance_percentile($1, $2, $3, $4::TIMESTAMPTZ)`, p, b)
+}
+
+// nearestNeighbour is the distance to the most similar purchase in the
+// baseline. Unlike the other strategies, it doesn't penalise purchases that
+// match an uncommon but established habit. Only the customer's own purchases
+// can be searched with the vector index. Confirmed fraud isn't compared
+// against, so repeating a fraudulent purchase doesn't make it look normal.
+type nearestNeighbour struct{}
+
+func (nearestNeighbour) DefaultThreshold() float64 { return 0.2 }
+
+func (nearestNeighbour) Score(ctx context.Context, q Queryer, p models.PurchaseMessage, b Baseline) (float64, error) {
+	// Confirmed fraud and later purchases are filtered from a handful of the
+	// nearest purchases rather than before the search, so the vector index
+	// can still be used.
+	const customerStmt = `SELECT dist FROM (
+			SELECT id, customer_id, ts, vec <-> $1::VECTOR AS dist
+			FROM purchase
+			WHERE customer_id = $2
+			AND id != $3
+			ORDER BY vec <-> $1::VECTOR
+			LIMIT 10
+		) AS nearest
+		WHERE ($4::TIMESTAMPTZ IS NULL OR nearest.ts < $4)
+		AND NOT EXISTS (
+			SELECT 1
+			FROM anomaly a
+			WHERE a.purchase_id = nearest.id
+			AND a.customer_id = nearest.customer_id
+			AND a.label = 'confirmed_fraud'
+		)
+		ORDER BY dist
+		LIMIT 1`
+
+	const baselineStmt = `SELECT vec <-> $1::VECTOR AS dist
+		FROM baseline_purchases($2, $4, $5::TIMESTAMPTZ)
+		WHERE id != $3
+		ORDER BY vec <-> $1::VECTOR
+		LIMIT 1`
+
+	var score float64
+	err := sql.ErrNoRows
+	if b == BaselineCustomer {
+		err = q.QueryRowContext(ctx, customerStmt, p.Vector.String(), p.CustomerID, p.ID, before(p)).Scan(&score)
+	}
+
+	// If every purchase the index found was filtered out, search the
+	// baseline without it.
+	if errors.Is(err, sql.ErrNoRows) {
+		err = q.QueryRowContext(ctx, baselineStmt, p.Vector.String(), p.CustomerID, p.ID, string(b), before(p)).Scan(&score)
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		// There's nothing to compare the first purchase against.
+		return 0, nil
+	}
+
+	return score, err
+}
+
+// scoreFunction runs a SQL function that scores a purchase. Functions return
+// NULL when a baseline can't produce a score, such as when all of its
+// purchases are identical, which is treated as a score of 0.
+func scoreFunction(ctx context.Context, q Queryer, stmt string, p models.PurchaseMessage, b Baseline) (float64, error) {
+	var score sql.NullFloat64
+	if err := q.QueryRowContext(ctx, stmt, p.ID, p.CustomerID, string(b), before(p)).Scan(&score); err != nil {
+		return 0, err
+	}
+
+	return score.Float64, nil
+}
+
+// before is when a purchase was made, which only earlier purchases are
+// compared against, or nil for messages without a timestamp.
+func before(p models.PurchaseMessage) any {
+	if p.Timestamp.IsZero() {
+		return nil
+	}
+
+	return p.Timestamp
+}
@@ -0,0 +1,161 @@
+package vectorize
+
+import (
+	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Purchase is what a purchase's vector is computed from.
+type Purchase struct {
+	Amount    float64
+	Timestamp time.Time
+	Lat       float64
+	Lon       float64
+}
+
+// FromMessage returns the parts of a purchase message that are vectorised,
+// and false if it has no location to vectorise.
+func FromMessage(m models.PurchaseMessage) (Purchase, bool) {
+	if m.Location == nil {
+		return Purchase{}, false
+	}
+
+	return Purchase{
+		Amount:    m.Amount,
+		Timestamp: m.Timestamp,
+		Lat:       m.Location.Lat,
+		Lon:       m.Location.Lon,
+	}, true
+}
+
+// Dimension is a named run of elements in a purchase's vector.
+type Dimension struct {
+	// Name is what purchase_distance_breakdown calls the dimension.
+	Name string
+
+	// Size is the number of elements Values returns.
+	Size int
+
+	Values func(p Purchase) []float64
+}
+
+var (
+	// Amount is the log of the amount, scaled down so large amounts don't
+	// outweigh the other dimensions. CockroachDB's LOG is base 10.
+	Amount = Dimension{
+		Name: "amount",
+		Size: 1,
+		Values: func(p Purchase) []float64 {
+			return []float64{0.35 * math.Log10(p.Amount+1)}
+		},
+	}
+
+	// HourOfDay is the hour the purchase was made, in UTC, from 0 to 1.
+	HourOfDay = Dimension{
+		Name: "hour_of_day",
+		Size: 1,
+		Values: func(p Purchase) []float64 {
+			return []float64{float64(p.Timestamp.UTC().Hour()) / 23}
+		},
+	}
+
+	// Location is where the purchase was made, as a point on the unit
+	// sphere, so nearby places are close whichever side of the antimeridian
+	// they're on.
+	Location = Dimension{
+		Name: "location",
+		Size: 3,
+		Values: func(p Purchase) []float64 {
+			lat, lon := radians(p.Lat), radians(p.Lon)
+
+			return []float64{
+				math.Cos(lat) * math.Cos(lon),
+				math.Cos(lat) * math.Sin(lon),
+				math.Sin(lat),
+			}
+		},
+	}
+)
+
+// Dimensions make up a purchase's vector, in order. They must match the
+// vectorize_purchase_before_insert trigger, so adding one means adding it
+// there, resizing the purchase table's vec column, and naming it in
+// purchase_distance_breakdown.
+var Dimensions = []Dimension{
+	Amount,
+	HourOfDay,
+	Location,
+}
+
+// Size is the number of elements in a purchase's vector.
+func Size() int {
+	var size int
+	for _, d := range Dimensions {
+		size += d.Size
+	}
+
+	return size
+}
+
+// Vector returns a purchase's vector, as the vectorize_purchase_before_insert
+// trigger computes it.
+func Vector(p Purchase) models.VectorString {
+	v := make(models.VectorString, 0, Size())
+	for _, d := range Dimensions {
+		v = append(v, d.Values(p)...)
+	}
+
+	return v
+}
+
+// Contribution is how much a dimension contributed to the distance between
+// two vectors, as a percentage.
+type Contribution struct {
+	Dimension string
+	Percent   float64
+}
+
+// Breakdown returns how much each dimension contributed to the squared
+// distance between a vector and a baseline, such as the average of a
+// customer's purchases, rounded as purchase_distance_breakdown rounds it.
+// Both vectors must have Size elements, and identical vectors have no
+// breakdown.
+func Breakdown(v, baseline []float64) []Contribution {
+	var total float64
+	squared := make([]float64, len(Dimensions))
+
+	var i int
+	for j, d := range Dimensions {
+		for range d.Size {
+			diff := v[i] - baseline[i]
+			squared[j] += diff * diff
+			i++
+		}
+		total += squared[j]
+	}
+
+	if total == 0 {
+		return nil
+	}
+
+	contributions := make([]Contribution, len(Dimensions))
+	for j, d := range Dimensions {
+		contributions[j] = Contribution{
+			Dimension: d.Name,
+			Percent:   math.Round(squared[j]/total*100*100) / 100,
+		}
+	}
+
+	slices.SortFunc(contributions, func(a, b Contribution) int {
+		return strings.Compare(a.Dimension, b.Dimension)
+	})
+
+	return contributions
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
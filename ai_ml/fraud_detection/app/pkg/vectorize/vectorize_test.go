@@ -0,0 +1,142 @@
+package vectorize
+
+import (
+	"context"
+	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/stretchr/testify/assert"
+)
+
+// formulaCases are checked against the vectorize_purchase_before_insert
+// trigger's formulas: 0.35 * LOG(amount + 1) (base 10), EXTRACT(HOUR FROM ts)
+// / 23, and the location's position on the unit sphere.
+var formulaCases = []struct {
+	name     string
+	purchase Purchase
+	exp      []float64
+}{
+	{
+		name:     "origin at midnight",
+		purchase: Purchase{Amount: 9, Timestamp: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		exp:      []float64{0.35, 0, 1, 0, 0},
+	},
+	{
+		name:     "east at the last hour",
+		purchase: Purchase{Amount: 99, Timestamp: time.Date(2025, 1, 1, 23, 59, 59, 0, time.UTC), Lon: 90},
+		exp:      []float64{0.7, 1, 0, 1, 0},
+	},
+	{
+		name:     "north pole in another time zone",
+		purchase: Purchase{Amount: 999, Timestamp: time.Date(2025, 1, 1, 11, 30, 0, 0, time.FixedZone("CEST", 2*60*60)), Lat: 90},
+		exp:      []float64{1.05, 9.0 / 23, 0, 0, 1},
+	},
+	{
+		name:     "london",
+		purchase: Purchase{Amount: 50, Timestamp: time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC), Lat: 51.5072, Lon: -0.1276},
+		exp:      []float64{0.5976495616342776, 0.34782608695652173, 0.6224147427804593, -0.0013861448985279822, 0.7826863781693502},
+	},
+}
+
+func TestVectorFormulas(t *testing.T) {
+	for _, c := range formulaCases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.InDeltaSlice(t, c.exp, Vector(c.purchase), 1e-9)
+		})
+	}
+}
+
+// TestVectorParity inserts purchases with the trigger in place, and checks
+// that it vectorises them as Vector does. The inserts are rolled back.
+func TestVectorParity(t *testing.T) {
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		t.Skip("DATABASE_URL isn't set")
+	}
+
+	db, err := sql.Open("pgx", url)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer tx.Rollback()
+
+	var customerID string
+	err = tx.QueryRowContext(ctx, `INSERT INTO customer (email) VALUES ('parity@example.com') RETURNING id`).Scan(&customerID)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	const stmt = `INSERT INTO purchase (customer_id, amount, location, ts)
+		VALUES ($1, $2, ST_MakePoint($3, $4)::GEOGRAPHY, $5)
+		RETURNING vec::STRING`
+
+	for _, c := range formulaCases {
+		t.Run(c.name, func(t *testing.T) {
+			p := c.purchase
+
+			var vec string
+			err := tx.QueryRowContext(ctx, stmt, customerID, p.Amount, p.Lon, p.Lat, p.Timestamp).Scan(&vec)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			act, err := models.ParseVector(vec)
+			assert.NoError(t, err)
+			assert.InDeltaSlice(t, Vector(p), act, 1e-6)
+		})
+	}
+}
+
+func TestSize(t *testing.T) {
+	// The purchase table's vec column is a VECTOR(5).
+	assert.Equal(t, 5, Size())
+	assert.Len(t, Vector(Purchase{}), Size())
+}
+
+func TestFromMessage(t *testing.T) {
+	var m models.PurchaseMessage
+	err := json.Unmarshal([]byte(`{
+		"amount": 9,
+		"ts": "2025-01-01T00:30:00Z",
+		"location": {"type": "Point", "coordinates": [90, 0]}
+	}`), &m)
+	assert.NoError(t, err)
+
+	p, ok := FromMessage(m)
+	assert.True(t, ok)
+	assert.InDeltaSlice(t, []float64{0.35, 0, 0, 1, 0}, Vector(p), 1e-9)
+
+	_, ok = FromMessage(models.PurchaseMessage{Amount: 9})
+	assert.False(t, ok)
+}
+
+func TestBreakdown(t *testing.T) {
+	exp := []Contribution{
+		{Dimension: "amount", Percent: 36},
+		{Dimension: "hour_of_day", Percent: 64},
+		{Dimension: "location", Percent: 0},
+	}
+	assert.Equal(t, exp, Breakdown([]float64{0.7, 0.4, 1, 0, 0}, []float64{0.4, 0, 1, 0, 0}))
+
+	exp = []Contribution{
+		{Dimension: "amount", Percent: 33.33},
+		{Dimension: "hour_of_day", Percent: 0},
+		{Dimension: "location", Percent: 66.67},
+	}
+	assert.Equal(t, exp, Breakdown([]float64{1, 0, 1, 1, 0}, []float64{0, 0, 0, 0, 0}))
+
+	assert.Nil(t, Breakdown([]float64{1, 0, 1, 0, 0}, []float64{1, 0, 1, 0, 0}))
+}
@@ -0,0 +1,301 @@
+package workload
+
+import (
+	"crdb/ai_ml/fraud_detection/app/pkg/models"
+	"crdb/ai_ml/fraud_detection/app/pkg/vectorize"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+)
+
+// Pattern is a kind of fraud the workload injects.
+type Pattern string
+
+const (
+	// PatternForeignLocation is a purchase in another customer's city.
+	PatternForeignLocation Pattern = "foreign_location"
+
+	// PatternOddHour is a purchase at an hour the customer doesn't shop.
+	PatternOddHour Pattern = "odd_hour"
+
+	// PatternLargeAmount is a purchase many times what the customer spends.
+	PatternLargeAmount Pattern = "large_amount"
+
+	// PatternBurst is a series of purchases in quick succession.
+	PatternBurst Pattern = "burst"
+)
+
+// Patterns lists every pattern.
+var Patterns = []Pattern{
+	PatternForeignLocation,
+	PatternOddHour,
+	PatternLargeAmount,
+	PatternBurst,
+}
+
+// ParsePatterns parses a comma-separated list of patterns, or "all".
+func ParsePatterns(s string) ([]Pattern, error) {
+	if strings.TrimSpace(s) == "all" {
+		return Patterns, nil
+	}
+
+	var patterns []Pattern
+	for _, part := range strings.Split(s, ",") {
+		p := Pattern(strings.TrimSpace(part))
+		if !slices.Contains(Patterns, p) {
+			return nil, fmt.Errorf("unsupported fraud pattern: %q", p)
+		}
+
+		if !slices.Contains(patterns, p) {
+			patterns = append(patterns, p)
+		}
+	}
+
+	return patterns, nil
+}
+
+// Customer is a customer to create, along with how they shop.
+type Customer struct {
+	ID               string
+	Email            string
+	Phone            string
+	PreferredContact string
+	Habit            Habit
+}
+
+// Purchase is a purchase to make. Pattern is the fraud it was injected as,
+// and is empty for legitimate purchases.
+type Purchase struct {
+	CustomerID string
+	Amount     float64
+	Lat        float64
+	Lon        float64
+	Timestamp  time.Time
+	Pattern    Pattern
+}
+
+// Vector returns the vector the purchase will be stored with.
+func (p Purchase) Vector() models.VectorString {
+	return vectorize.Vector(vectorize.Purchase{
+		Amount:    p.Amount,
+		Timestamp: p.Timestamp,
+		Lat:       p.Lat,
+		Lon:       p.Lon,
+	})
+}
+
+// Config is how a Generator injects fraud.
+type Config struct {
+	// FraudRate is the chance that a purchase is fraud, from 0 to 1.
+	FraudRate float64
+
+	// Patterns are the kinds of fraud to inject, picked between at random.
+	Patterns []Pattern
+
+	// BurstSize is the number of purchases in a burst, made BurstWindow
+	// apart at most.
+	BurstSize   int
+	BurstWindow time.Duration
+}
+
+func (c Config) validate() error {
+	if c.FraudRate < 0 || c.FraudRate > 1 {
+		return fmt.Errorf("fraud rate must be between 0 and 1: %v", c.FraudRate)
+	}
+
+	if c.FraudRate > 0 && len(c.Patterns) == 0 {
+		return errors.New("injecting fraud needs at least one pattern")
+	}
+
+	if slices.Contains(c.Patterns, PatternBurst) && (c.BurstSize < 2 || c.BurstWindow <= 0) {
+		return errors.New("bursts need at least 2 purchases and a window")
+	}
+
+	return nil
+}
+
+// Generator generates customers and their purchases. It isn't safe for
+// concurrent use.
+type Generator struct {
+	cfg   Config
+	rng   *rand.Rand
+	faker *gofakeit.Faker
+}
+
+// NewGenerator returns a Generator whose output is determined by its seed.
+func NewGenerator(cfg Config, seed uint64) (*Generator, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return &Generator{
+		cfg:   cfg,
+		rng:   rand.New(rand.NewPCG(seed, seed)),
+		faker: gofakeit.New(seed),
+	}, nil
+}
+
+// Customer returns a new customer.
+func (g *Generator) Customer() Customer {
+	id := g.faker.UUID()
+
+	contact := "email"
+	if g.rng.Float64() < 0.2 {
+		contact = "sms"
+	}
+
+	return Customer{
+		ID:               id,
+		Email:            g.faker.Email(),
+		Phone:            g.faker.Phone(),
+		PreferredContact: contact,
+		Habit:            HabitFor(id),
+	}
+}
+
+// Pick returns one of the given customers at random.
+func (g *Generator) Pick(customerIDs []string) string {
+	return customerIDs[g.rng.IntN(len(customerIDs))]
+}
+
+// History returns n legitimate purchases made by a customer in the 30 days
+// before end, oldest first, to give them a baseline.
+func (g *Generator) History(customerID string, h Habit, n int, end time.Time) []Purchase {
+	purchases := make([]Purchase, n)
+	for i := range purchases {
+		day := end.AddDate(0, 0, -1-g.rng.IntN(30))
+		ts := g.atHour(day, h.FirstHour+g.rng.IntN(h.Hours))
+		purchases[i] = g.usual(customerID, h, ts)
+	}
+
+	slices.SortFunc(purchases, func(a, b Purchase) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+
+	return purchases
+}
+
+// Next returns a customer's next purchase, or purchases if a burst of fraud
+// is injected. Purchases are made no later than now.
+func (g *Generator) Next(customerID string, h Habit, now time.Time) []Purchase {
+	if g.rng.Float64() >= g.cfg.FraudRate {
+		return []Purchase{g.usual(customerID, h, g.lastUsual(h, now))}
+	}
+
+	return g.Fraud(customerID, h, now, g.cfg.Patterns[g.rng.IntN(len(g.cfg.Patterns))])
+}
+
+// Fraud returns a fraudulent purchase, or purchases for a burst, that differs
+// from a customer's habit in the way its pattern describes, and is otherwise
+// usual for them.
+func (g *Generator) Fraud(customerID string, h Habit, now time.Time, pattern Pattern) []Purchase {
+	p := g.usual(customerID, h, g.lastUsual(h, now))
+	p.Pattern = pattern
+
+	switch pattern {
+	case PatternForeignLocation:
+		p.Lat, p.Lon = g.abroad(h)
+
+	case PatternOddHour:
+		var odd []int
+		for hour := range 24 {
+			if !h.Usual(hour) {
+				odd = append(odd, hour)
+			}
+		}
+		p.Timestamp = g.lastAt(odd[g.rng.IntN(len(odd))], now)
+
+	case PatternLargeAmount:
+		p.Amount = round(h.Amount * (10 + g.rng.Float64()*40))
+
+	case PatternBurst:
+		burst := make([]Purchase, g.cfg.BurstSize)
+		ts := p.Timestamp
+
+		// Work backwards from the last purchase, so none are in the future.
+		for i := len(burst) - 1; i >= 0; i-- {
+			burst[i] = g.usual(customerID, h, ts)
+			burst[i].Pattern = pattern
+			ts = ts.Add(-time.Duration(1 + g.rng.Int64N(int64(g.cfg.BurstWindow))))
+		}
+		return burst
+	}
+
+	return []Purchase{p}
+}
+
+// usual returns a purchase near the customer's home, for around what they
+// usually spend.
+func (g *Generator) usual(customerID string, h Habit, ts time.Time) Purchase {
+	amount := h.Amount + g.rng.NormFloat64()*h.AmountSpread
+
+	return Purchase{
+		CustomerID: customerID,
+		Amount:     round(max(amount, 1)),
+		Lat:        h.Lat + (g.rng.Float64()-0.5)*0.05,
+		Lon:        h.Lon + (g.rng.Float64()-0.5)*0.05,
+		Timestamp:  ts,
+	}
+}
+
+// abroad returns a location in a city other than the customer's.
+func (g *Generator) abroad(h Habit) (float64, float64) {
+	var others []City
+	for _, c := range Cities {
+		if c.Region != h.Home.Region {
+			others = append(others, c)
+		}
+	}
+
+	c := others[g.rng.IntN(len(others))]
+	return c.Lat + (g.rng.Float64()-0.5)*0.1, c.Lon + (g.rng.Float64()-0.5)*0.1
+}
+
+// lastUsual returns a time in the most recent hour the customer usually
+// shops, no later than now.
+func (g *Generator) lastUsual(h Habit, now time.Time) time.Time {
+	now = now.UTC()
+
+	hour := now.Hour()
+	for !h.Usual(hour) {
+		hour = (hour + 23) % 24
+	}
+
+	return g.lastAt(hour, now)
+}
+
+// lastAt returns a random time in the most recent occurrence of an hour, no
+// later than now.
+func (g *Generator) lastAt(hour int, now time.Time) time.Time {
+	now = now.UTC()
+
+	if hour == now.Hour() {
+		start := now.Truncate(time.Hour)
+		return start.Add(time.Duration(g.rng.Int64N(int64(now.Sub(start)) + 1)))
+	}
+
+	day := now
+	if hour > now.Hour() {
+		day = now.AddDate(0, 0, -1)
+	}
+
+	return g.atHour(day, hour)
+}
+
+// atHour returns a random time in an hour of a day.
+func (g *Generator) atHour(day time.Time, hour int) time.Time {
+	y, m, d := day.UTC().Date()
+	start := time.Date(y, m, d, hour%24, 0, 0, 0, time.UTC)
+
+	return start.Add(time.Duration(g.rng.Int64N(int64(time.Hour))))
+}
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
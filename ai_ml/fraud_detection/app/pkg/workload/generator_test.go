@@ -0,0 +1,142 @@
+package workload
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestGenerator(t *testing.T, fraudRate float64) *Generator {
+	g, err := NewGenerator(Config{
+		FraudRate:   fraudRate,
+		Patterns:    Patterns,
+		BurstSize:   4,
+		BurstWindow: 10 * time.Second,
+	}, 42)
+	assert.NoError(t, err)
+
+	return g
+}
+
+func TestHabitFor(t *testing.T) {
+	h := HabitFor("c7fc4006-3f39-4baf-ad93-5870f3ec27ec")
+	assert.Equal(t, h, HabitFor("c7fc4006-3f39-4baf-ad93-5870f3ec27ec"))
+
+	assert.True(t, h.Usual(h.FirstHour))
+	assert.True(t, h.Usual((h.FirstHour+h.Hours-1)%24))
+	assert.False(t, h.Usual((h.FirstHour+h.Hours)%24))
+}
+
+func TestHabitUsualWraps(t *testing.T) {
+	h := Habit{FirstHour: 20, Hours: 8}
+
+	assert.True(t, h.Usual(23))
+	assert.True(t, h.Usual(3))
+	assert.False(t, h.Usual(4))
+	assert.False(t, h.Usual(19))
+}
+
+func TestParsePatterns(t *testing.T) {
+	patterns, err := ParsePatterns("all")
+	assert.NoError(t, err)
+	assert.Equal(t, Patterns, patterns)
+
+	patterns, err = ParsePatterns("burst, odd_hour,burst")
+	assert.NoError(t, err)
+	assert.Equal(t, []Pattern{PatternBurst, PatternOddHour}, patterns)
+
+	_, err = ParsePatterns("burst,phishing")
+	assert.EqualError(t, err, `unsupported fraud pattern: "phishing"`)
+}
+
+func TestNewGenerator(t *testing.T) {
+	_, err := NewGenerator(Config{FraudRate: 1.5, Patterns: Patterns}, 1)
+	assert.Error(t, err)
+
+	_, err = NewGenerator(Config{FraudRate: 0.1}, 1)
+	assert.Error(t, err)
+
+	_, err = NewGenerator(Config{FraudRate: 0.1, Patterns: []Pattern{PatternBurst}, BurstSize: 1, BurstWindow: time.Second}, 1)
+	assert.Error(t, err)
+
+	_, err = NewGenerator(Config{}, 1)
+	assert.NoError(t, err)
+}
+
+func TestHistory(t *testing.T) {
+	g := newTestGenerator(t, 0)
+	c := g.Customer()
+	end := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	purchases := g.History(c.ID, c.Habit, 50, end)
+	assert.Len(t, purchases, 50)
+
+	for i, p := range purchases {
+		assert.Equal(t, c.ID, p.CustomerID)
+		assert.Empty(t, p.Pattern)
+		assert.True(t, c.Habit.Usual(p.Timestamp.Hour()))
+		assert.True(t, p.Timestamp.Before(end))
+		assert.InDelta(t, c.Habit.Lat, p.Lat, 0.05)
+
+		if i > 0 {
+			assert.False(t, p.Timestamp.Before(purchases[i-1].Timestamp))
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	g := newTestGenerator(t, 0)
+	h := HabitFor("c1")
+
+	// Whatever the time, legitimate purchases are made at a usual hour, and
+	// not in the future.
+	for hour := range 24 {
+		now := time.Date(2025, 6, 1, hour, 30, 0, 0, time.UTC)
+
+		purchases := g.Next("c1", h, now)
+		assert.Len(t, purchases, 1)
+		assert.Empty(t, purchases[0].Pattern)
+		assert.True(t, h.Usual(purchases[0].Timestamp.Hour()))
+		assert.False(t, purchases[0].Timestamp.After(now))
+	}
+
+	g = newTestGenerator(t, 1)
+	for range 20 {
+		purchases := g.Next("c1", h, time.Now())
+		assert.NotEmpty(t, purchases[0].Pattern)
+	}
+}
+
+func TestFraud(t *testing.T) {
+	g := newTestGenerator(t, 1)
+	h := HabitFor("c1")
+	now := time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC)
+
+	foreign := g.Fraud("c1", h, now, PatternForeignLocation)
+	assert.Len(t, foreign, 1)
+	assert.Greater(t, math.Abs(foreign[0].Lat-h.Lat)+math.Abs(foreign[0].Lon-h.Lon), 1.0)
+
+	odd := g.Fraud("c1", h, now, PatternOddHour)
+	assert.Len(t, odd, 1)
+	assert.False(t, h.Usual(odd[0].Timestamp.Hour()))
+	assert.False(t, odd[0].Timestamp.After(now))
+
+	large := g.Fraud("c1", h, now, PatternLargeAmount)
+	assert.Len(t, large, 1)
+	assert.GreaterOrEqual(t, large[0].Amount, h.Amount*10)
+
+	burst := g.Fraud("c1", h, now, PatternBurst)
+	assert.Len(t, burst, 4)
+	for i, p := range burst {
+		assert.Equal(t, PatternBurst, p.Pattern)
+		assert.False(t, p.Timestamp.After(now))
+
+		if i > 0 {
+			gap := p.Timestamp.Sub(burst[i-1].Timestamp)
+			assert.Greater(t, gap, time.Duration(0))
+			assert.LessOrEqual(t, gap, 10*time.Second)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package workload
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+)
+
+// City is somewhere customers live.
+type City struct {
+	Name   string
+	Region string
+	Locale string
+	Lat    float64
+	Lon    float64
+}
+
+// Cities are where customers live, each in its own region.
+var Cities = []City{
+	{Name: "London", Region: "uk", Locale: "en", Lat: 51.5072, Lon: -0.1276},
+	{Name: "Paris", Region: "fr", Locale: "fr", Lat: 48.8566, Lon: 2.3522},
+	{Name: "Berlin", Region: "de", Locale: "de", Lat: 52.5200, Lon: 13.4050},
+	{Name: "Madrid", Region: "es", Locale: "es", Lat: 40.4168, Lon: -3.7038},
+	{Name: "New York", Region: "us", Locale: "en", Lat: 40.7128, Lon: -74.0060},
+}
+
+// Habit is how a customer usually shops: near home, during the same hours of
+// the day, and spending similar amounts.
+type Habit struct {
+	Home City
+
+	// Lat and Lon are the customer's home, somewhere in their city.
+	Lat float64
+	Lon float64
+
+	// FirstHour and Hours are when the customer shops, from FirstHour (UTC)
+	// for Hours hours, wrapping past midnight.
+	FirstHour int
+	Hours     int
+
+	// Amount and AmountSpread are what the customer usually spends, and how
+	// far either side of it they stray.
+	Amount       float64
+	AmountSpread float64
+}
+
+// HabitFor returns a customer's habit. It's derived from their ID, so it's the
+// same every time the workload runs, without being stored.
+func HabitFor(customerID string) Habit {
+	h := fnv.New64a()
+	h.Write([]byte(customerID))
+	seed := h.Sum64()
+
+	rng := rand.New(rand.NewPCG(seed, seed))
+	home := Cities[rng.IntN(len(Cities))]
+	amount := 10 + rng.Float64()*90
+
+	return Habit{
+		Home:         home,
+		Lat:          home.Lat + (rng.Float64()-0.5)*0.2,
+		Lon:          home.Lon + (rng.Float64()-0.5)*0.2,
+		FirstHour:    7 + rng.IntN(5),
+		Hours:        8 + rng.IntN(5),
+		Amount:       amount,
+		AmountSpread: amount * 0.3,
+	}
+}
+
+// Usual reports whether customers with this habit usually shop at an hour.
+func (h Habit) Usual(hour int) bool {
+	return (hour-h.FirstHour+24)%24 < h.Hours
+}
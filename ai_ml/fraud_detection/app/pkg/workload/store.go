@@ -0,0 +1,90 @@
+package workload
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Store writes the workload to the database.
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+// CreateCustomer stores a customer, in the region and with the locale of
+// their home city.
+func (s *Store) CreateCustomer(ctx context.Context, c Customer) error {
+	const stmt = `INSERT INTO customer (id, email, phone, preferred_contact, region, locale)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+
+	_, err := s.db.ExecContext(ctx, stmt, c.ID, c.Email, c.Phone, c.PreferredContact, c.Habit.Home.Region, c.Habit.Home.Locale)
+	if err != nil {
+		return fmt.Errorf("executing query: %w", err)
+	}
+
+	return nil
+}
+
+// Customers returns the IDs of every customer.
+func (s *Store) Customers(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM customer`)
+	if err != nil {
+		return nil, fmt.Errorf("making query: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// Insert stores purchases in a single transaction, labelling the fraud among
+// them with the pattern it was injected as.
+func (s *Store) Insert(ctx context.Context, purchases []Purchase) error {
+	const purchaseStmt = `INSERT INTO purchase (customer_id, amount, location, ts)
+		VALUES ($1, $2, ST_SetSRID(ST_MakePoint($3, $4), 4326)::GEOGRAPHY, $5)
+		RETURNING id`
+
+	const labelStmt = `INSERT INTO purchase_label (purchase_id, pattern) VALUES ($1, $2)`
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, p := range purchases {
+		var id string
+		err = tx.QueryRowContext(ctx, purchaseStmt, p.CustomerID, p.Amount, p.Lon, p.Lat, p.Timestamp).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("inserting purchase: %w", err)
+		}
+
+		if p.Pattern == "" {
+			continue
+		}
+
+		if _, err = tx.ExecContext(ctx, labelStmt, id, string(p.Pattern)); err != nil {
+			return fmt.Errorf("labelling purchase: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
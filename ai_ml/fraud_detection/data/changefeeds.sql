@@ -3,7 +3,10 @@ SET CLUSTER SETTING kv.rangefeed.enabled = 't';
 CREATE CHANGEFEED FOR TABLE "purchase"
 INTO "kafka://kafka.default.svc.cluster.local:29092"
 WITH
-  envelope = 'row',
+  envelope = 'wrapped',
+  diff,
+  updated,
+  resolved = '10s',
   initial_scan = 'no',
   kafka_sink_config = '{
     "Flush": {
@@ -16,7 +19,10 @@ WITH
 CREATE CHANGEFEED FOR TABLE "anomaly"
 INTO "kafka://kafka.default.svc.cluster.local:29092"
 WITH
-  envelope = 'row',
+  envelope = 'wrapped',
+  diff,
+  updated,
+  resolved = '10s',
   initial_scan = 'no',
   kafka_sink_config = '{
     "Flush": {
@@ -29,7 +35,10 @@ WITH
 CREATE CHANGEFEED FOR TABLE "notification"
 INTO "kafka://kafka.default.svc.cluster.local:29092"
 WITH
-  envelope = 'row',
+  envelope = 'wrapped',
+  diff,
+  updated,
+  resolved = '10s',
   initial_scan = 'no',
   kafka_sink_config = '{
     "Flush": {
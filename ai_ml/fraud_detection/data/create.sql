@@ -7,7 +7,23 @@ CREATE TABLE customer (
   "id" UUID PRIMARY KEY DEFAULT gen_random_uuid(),
   "email" STRING NOT NULL,
   "phone" STRING,
-  "preferred_contact" preferred_contact NOT NULL DEFAULT 'email'
+  "preferred_contact" preferred_contact NOT NULL DEFAULT 'email',
+
+  -- Customers in the same region form the cohort that new customers'
+  -- purchases are compared against.
+  "region" STRING,
+
+  -- Override the agent's scoring strategy and threshold for this customer.
+  "anomaly_strategy" STRING,
+  "anomaly_threshold" FLOAT,
+
+  -- Override the amount_cap rule's limit for this customer.
+  "amount_cap" DECIMAL,
+
+  -- The language to write notifications in, such as 'fr' or 'pt-BR'.
+  "locale" STRING NOT NULL DEFAULT 'en',
+
+  INDEX ("region")
 );
 
 CREATE TABLE purchase (
@@ -18,33 +34,107 @@ CREATE TABLE purchase (
   "ts" TIMESTAMPTZ DEFAULT now(),
   "vec" VECTOR(5) NOT NULL,
   
-  VECTOR INDEX (customer_id, vec)
+  VECTOR INDEX (customer_id, vec),
+  INDEX (customer_id, ts),
+  INDEX (ts)
+);
+
+-- Fraud injected by the Go workload, labelled with its pattern (such as
+-- 'foreign_location'), so detection can be measured against it.
+CREATE TABLE purchase_label (
+  "purchase_id" UUID PRIMARY KEY REFERENCES purchase ("id"),
+  "pattern" STRING NOT NULL,
+  "ts" TIMESTAMPTZ DEFAULT now()
 );
 
 CREATE TYPE anomaly_status AS ENUM ('pending', 'processed');
+CREATE TYPE review_outcome AS ENUM ('confirmed_fraud', 'dismissed', 'approved');
+CREATE TYPE anomaly_label AS ENUM ('confirmed_fraud', 'false_positive');
 
 CREATE TABLE anomaly (
   "purchase_id" UUID NOT NULL REFERENCES purchase ("id"),
   "customer_id" UUID NOT NULL REFERENCES customer ("id"),
   "score" DECIMAL NOT NULL,
+  "strategy" STRING,
+  "baseline" STRING,
   "status" anomaly_status NOT NULL DEFAULT 'pending',
+
+  -- An analyst's decision on the anomaly, from the review service.
+  "review" review_outcome,
+  "reviewed_by" STRING,
+  "reviewed_at" TIMESTAMPTZ,
+
+  -- Whether the purchase was fraudulent, from the customer ('customer') or,
+  -- failing that, an analyst's review ('analyst').
+  "label" anomaly_label,
+  "label_source" STRING,
+  "labelled_at" TIMESTAMPTZ,
+
   "ts" TIMESTAMPTZ DEFAULT now(),
 
-  PRIMARY KEY ("purchase_id", "customer_id")
+  PRIMARY KEY ("purchase_id", "customer_id"),
+  INDEX ("ts") WHERE "review" IS NULL
+);
+
+-- How often each customer's anomalies turn out to be purchases they made.
+CREATE VIEW customer_false_positive_rate AS
+  SELECT
+    customer_id,
+    count(*) AS anomalies,
+    count(label) AS labelled,
+    count(*) FILTER (WHERE label = 'false_positive') AS false_positives,
+    (count(*) FILTER (WHERE label = 'false_positive'))::FLOAT / NULLIF(count(label), 0) AS rate
+  FROM anomaly
+  GROUP BY customer_id;
+
+-- Rules that a purchase broke, which made it anomalous or added to why.
+CREATE TABLE anomaly_rule (
+  "purchase_id" UUID NOT NULL,
+  "customer_id" UUID NOT NULL,
+  "rule" STRING NOT NULL,
+  "type" STRING NOT NULL,
+  "detail" STRING NOT NULL,
+  "ts" TIMESTAMPTZ DEFAULT now(),
+
+  PRIMARY KEY ("purchase_id", "customer_id", "rule"),
+  FOREIGN KEY ("purchase_id", "customer_id") REFERENCES anomaly ("purchase_id", "customer_id")
 );
 
-CREATE TYPE notification_status AS ENUM ('pending', 'sent');
+-- Notifications awaiting review are held until an analyst releases them
+-- (making them pending) or dismisses them. The notification agent claims a
+-- pending notification by making it sending, before contacting the customer.
+CREATE TYPE notification_status AS ENUM ('review', 'pending', 'sending', 'sent', 'dismissed');
+CREATE TYPE recommended_action AS ENUM ('block', 'verify', 'ignore');
 
 CREATE TABLE notification (
   "purchase_id" UUID NOT NULL REFERENCES purchase ("id"),
   "customer_id" UUID NOT NULL REFERENCES customer ("id"),
   "reasoning" STRING NOT NULL,
+  "primary_reason" STRING NOT NULL,
+  "confidence" FLOAT NOT NULL,
+  "action" recommended_action NOT NULL,
+  "prompt_version" STRING NOT NULL,
   "status" notification_status NOT NULL DEFAULT 'pending',
   "ts" TIMESTAMPTZ DEFAULT now(),
 
   PRIMARY KEY ("purchase_id", "customer_id")
 );
 
+-- Each attempt at delivering a notification, successful or not.
+CREATE TABLE notification_attempt (
+  "id" UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  "purchase_id" UUID NOT NULL,
+  "customer_id" UUID NOT NULL,
+  "channel" STRING NOT NULL,
+  "target" STRING NOT NULL,
+  "provider_message_id" STRING,
+  "error" STRING,
+  "ts" TIMESTAMPTZ DEFAULT now(),
+
+  FOREIGN KEY ("purchase_id", "customer_id") REFERENCES notification ("purchase_id", "customer_id"),
+  INDEX ("purchase_id", "customer_id")
+);
+
 -- Presplit purchase to help with changefeed concurrency.
 ALTER TABLE purchase SPLIT AT
   SELECT rpad(to_hex(prefix::INT), 32, '0')::UUID
@@ -63,6 +153,8 @@ DECLARE
   vec FLOAT[];
 BEGIN
 
+  -- Keep in step with app/pkg/vectorize, which computes the same vector.
+
   -- Vectorize amount (downscaled).
   amount_dim := 0.35 * LOG((NEW).amount + 1);
 
@@ -154,12 +246,76 @@ RETURNS TABLE (
   LIMIT limit_count;
 $$ LANGUAGE SQL;
 
-CREATE OR REPLACE FUNCTION purchase_distance_from_average(
-  purchase_id UUID,
-  cust_id UUID
+-- The purchases that a customer's purchases are compared against: their own
+-- ('customer'), those of customers in the same region ('cohort'), or
+-- everyone's ('population'). Confirmed fraud is left out, so it doesn't
+-- become normal, and so are purchases made from p_before onwards, if it's
+-- given, so a purchase can be scored as it would have been when it was made.
+-- Cohort and population baselines are limited to the most recent 10,000
+-- purchases from the 30 days before p_before (or now), so scoring a new
+-- customer's purchase doesn't scan every purchase.
+CREATE OR REPLACE FUNCTION baseline_purchases(
+  cust_id UUID,
+  p_baseline STRING,
+  p_before TIMESTAMPTZ DEFAULT NULL
 )
-RETURNS FLOAT AS $$
+RETURNS TABLE(
+  id UUID,
+  vec VECTOR
+) AS $$
+  SELECT p.id, p.vec
+  FROM purchase p
+  WHERE p_baseline = 'customer'
+  AND p.customer_id = cust_id
+  AND p.vec IS NOT NULL
+  AND (p_before IS NULL OR p.ts < p_before)
+  AND NOT EXISTS (
+    SELECT 1
+    FROM anomaly a
+    WHERE a.purchase_id = p.id
+    AND a.customer_id = p.customer_id
+    AND a.label = 'confirmed_fraud'
+  )
+  UNION ALL
+  (
+    SELECT p.id, p.vec
+    FROM purchase p
+    WHERE p_baseline IN ('cohort', 'population')
+    AND p.ts >= COALESCE(p_before, now()) - INTERVAL '30 days'
+    AND p.ts < COALESCE(p_before, now())
+    AND p.vec IS NOT NULL
+    AND (
+      p_baseline = 'population'
+      OR p.customer_id IN (
+        SELECT c.id
+        FROM customer c
+        WHERE c.region = (SELECT region FROM customer WHERE id = cust_id)
+      )
+    )
+    AND NOT EXISTS (
+      SELECT 1
+      FROM anomaly a
+      WHERE a.purchase_id = p.id
+      AND a.customer_id = p.customer_id
+      AND a.label = 'confirmed_fraud'
+    )
+    ORDER BY p.ts DESC
+    LIMIT 10000
+  );
+$$ LANGUAGE SQL;
+
+-- The average vector of a baseline's purchases, which the purchase_distance
+-- functions measure purchases against.
+CREATE OR REPLACE FUNCTION baseline_average(
+  cust_id UUID,
+  p_baseline STRING,
+  p_before TIMESTAMPTZ DEFAULT NULL
+)
+RETURNS VECTOR AS $$
   WITH
+    baseline AS (
+      SELECT vec FROM baseline_purchases(cust_id, p_baseline, p_before)
+    ),
     element_sums AS (
       SELECT 
         position,
@@ -168,66 +324,108 @@ RETURNS FLOAT AS $$
         SELECT 
           unnest(vec::FLOAT[]) AS element,
           generate_subscripts(vec::FLOAT[], 1) AS position
-        FROM purchase
-        WHERE customer_id = cust_id
-        AND vec IS NOT NULL
+        FROM baseline
       ) AS unnested
       GROUP BY position
     ),
     total_rows AS (
       SELECT COUNT(*) AS row_count
-      FROM purchase
-      WHERE customer_id = cust_id
-      AND vec IS NOT NULL
+      FROM baseline
+    )
+  SELECT 
+    array_agg(sum_element / row_count::FLOAT ORDER BY position)::VECTOR
+  FROM element_sums
+  CROSS JOIN total_rows;
+$$ LANGUAGE SQL;
+
+CREATE OR REPLACE FUNCTION purchase_distance_from_average(
+  purchase_id UUID,
+  cust_id UUID,
+  p_baseline STRING,
+  p_before TIMESTAMPTZ DEFAULT NULL
+)
+RETURNS FLOAT AS $$
+  WITH
+    average_vec AS (
+      SELECT baseline_average(cust_id, p_baseline, p_before) AS v
+    )
+  SELECT
+    ROUND(t.vec <-> (SELECT v FROM average_vec), 3) AS dist_l2
+  FROM purchase t
+  WHERE t.id = purchase_id
+  AND t.vec IS NOT NULL;
+$$ LANGUAGE SQL;
+
+CREATE OR REPLACE FUNCTION purchase_distance_zscore(
+  purchase_id UUID,
+  cust_id UUID,
+  p_baseline STRING,
+  p_before TIMESTAMPTZ DEFAULT NULL
+)
+RETURNS FLOAT AS $$
+  WITH
+    baseline AS (
+      SELECT vec FROM baseline_purchases(cust_id, p_baseline, p_before)
     ),
     average_vec AS (
+      SELECT baseline_average(cust_id, p_baseline, p_before) AS v
+    ),
+    stddev_calc AS (
       SELECT 
-        array_agg(sum_element / row_count::FLOAT ORDER BY position)::VECTOR AS v
-      FROM element_sums
-      CROSS JOIN total_rows
+        stddev_pop(vec <-> (SELECT v FROM average_vec)) AS dist_stddev
+      FROM baseline
     )
   SELECT
-    ROUND(t.vec <-> (SELECT v FROM average_vec), 3) AS dist_l2
+    ROUND((t.vec <-> (SELECT v FROM average_vec)) / NULLIF((SELECT dist_stddev FROM stddev_calc), 0), 3) AS dist_zscore
+  FROM purchase t
+  WHERE t.id = purchase_id
+  AND t.vec IS NOT NULL;
+$$ LANGUAGE SQL;
+
+-- The fraction of baseline purchases that are closer to the baseline average
+-- than the given purchase.
+CREATE OR REPLACE FUNCTION purchase_distance_percentile(
+  purchase_id UUID,
+  cust_id UUID,
+  p_baseline STRING,
+  p_before TIMESTAMPTZ DEFAULT NULL
+)
+RETURNS FLOAT AS $$
+  WITH
+    baseline AS (
+      SELECT vec FROM baseline_purchases(cust_id, p_baseline, p_before)
+    ),
+    average_vec AS (
+      SELECT baseline_average(cust_id, p_baseline, p_before) AS v
+    ),
+    distances AS (
+      SELECT vec <-> (SELECT v FROM average_vec) AS dist
+      FROM baseline
+    )
+  SELECT
+    ROUND(
+      (SELECT COUNT(*) FROM distances WHERE dist < (t.vec <-> (SELECT v FROM average_vec)))::FLOAT
+        / NULLIF((SELECT COUNT(*) FROM distances), 0)::FLOAT,
+      3
+    ) AS dist_percentile
   FROM purchase t
-  CROSS JOIN average_vec
   WHERE t.id = purchase_id
   AND t.vec IS NOT NULL;
 $$ LANGUAGE SQL;
 
 CREATE OR REPLACE FUNCTION purchase_distance_breakdown(
   purchase_id UUID,
-  cust_id UUID
+  cust_id UUID,
+  p_baseline STRING,
+  p_before TIMESTAMPTZ DEFAULT NULL
 )
 RETURNS TABLE(
   dimension_name TEXT,
   contribution_pct FLOAT
 ) AS $$
   WITH
-    element_sums AS (
-      SELECT 
-        position,
-        SUM(element) AS sum_element
-      FROM (
-        SELECT 
-          unnest(vec::FLOAT[]) AS element,
-          generate_subscripts(vec::FLOAT[], 1) AS position
-        FROM purchase
-        WHERE customer_id = cust_id
-        AND vec IS NOT NULL
-      ) AS unnested
-      GROUP BY position
-    ),
-    total_rows AS (
-      SELECT COUNT(*) AS row_count
-      FROM purchase
-      WHERE customer_id = cust_id
-      AND vec IS NOT NULL
-    ),
     average_vec AS (
-      SELECT 
-        array_agg(sum_element / row_count::FLOAT ORDER BY position)::VECTOR AS v
-      FROM element_sums
-      CROSS JOIN total_rows
+      SELECT baseline_average(cust_id, p_baseline, p_before) AS v
     ),
     dimension_differences AS (
       SELECT
@@ -312,8 +510,11 @@ CREATE OR REPLACE PROCEDURE delete_customer_data(p_customer_id UUID)
 LANGUAGE plpgsql
 AS $$
 BEGIN
+    DELETE FROM notification_attempt WHERE customer_id = p_customer_id;
     DELETE FROM notification WHERE customer_id = p_customer_id;
+    DELETE FROM anomaly_rule WHERE customer_id = p_customer_id;
     DELETE FROM anomaly WHERE customer_id = p_customer_id;
+    DELETE FROM purchase_label WHERE purchase_id IN (SELECT id FROM purchase WHERE customer_id = p_customer_id);
     DELETE FROM purchase WHERE customer_id = p_customer_id;
     DELETE FROM customer WHERE id = p_customer_id;
 END;
@@ -1,9 +1,10 @@
 -- Insert a known customer.
-INSERT INTO customer(id, email, phone, preferred_contact) VALUES(
+INSERT INTO customer(id, email, phone, preferred_contact, region) VALUES(
   'c7fc4006-3f39-4baf-ad93-5870f3ec27ec',
   'anomalies@testing.com',
   '+441234567890',
-  'email'
+  'email',
+  'uk'
 );
 
 -- Insert regular purchases for them